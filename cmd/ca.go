@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zzong12/hprotoxy/log"
+	"github.com/zzong12/hprotoxy/mitm"
+)
+
+var (
+	caCertFile string
+	caKeyFile  string
+	caName     string
+	caDays     int
+	caForce    bool
+	caFormat   string
+)
+
+func init() {
+	caCmd.PersistentFlags().StringVar(&caCertFile, "cert", "", "ca certificate file, default is MITM.CACert of the config file")
+	caCmd.PersistentFlags().StringVar(&caKeyFile, "key", "", "ca private key file, default is MITM.CAKey of the config file")
+	caGenerateCmd.Flags().StringVar(&caName, "name", "hprotoxy CA", "common name of the ca certificate")
+	caGenerateCmd.Flags().IntVar(&caDays, "days", 3650, "validity of the ca certificate in days")
+	caGenerateCmd.Flags().BoolVar(&caForce, "force", false, "overwrite existing files")
+	caExportCmd.Flags().StringVar(&caFormat, "format", "pem", "output format, pem or der")
+
+	caCmd.AddCommand(caGenerateCmd, caExportCmd)
+	rootCmd.AddCommand(caCmd)
+}
+
+// caFiles returns the ca file paths from the flags, falling back to the
+// config file.
+func caFiles() (string, string) {
+	certFile, keyFile := caCertFile, caKeyFile
+	if certFile != "" && keyFile != "" {
+		return certFile, keyFile
+	}
+	if cfg, err := readConfig(); err == nil {
+		if certFile == "" {
+			certFile = cfg.MITM.CACert
+		}
+		if keyFile == "" {
+			keyFile = cfg.MITM.CAKey
+		}
+	}
+	if certFile == "" || keyFile == "" {
+		log.Log.Fatal("ca files not set, use --cert/--key or MITM.CACert/MITM.CAKey in the config file")
+	}
+	return certFile, keyFile
+}
+
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "Manage the CA used to intercept HTTPS CONNECT tunnels",
+}
+
+var caGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate a new CA certificate and private key",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		certFile, keyFile := caFiles()
+		if !caForce {
+			for _, f := range []string{certFile, keyFile} {
+				if _, err := os.Stat(f); err == nil {
+					log.Log.Fatalf("%s already exists, use --force to overwrite", f)
+				}
+			}
+		}
+		certPEM, keyPEM, err := mitm.GenerateCA(caName, time.Duration(caDays)*24*time.Hour)
+		if err != nil {
+			log.Log.Fatalf("generate ca error: %v", err)
+		}
+		if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+			log.Log.Fatalf("write ca key error: %v", err)
+		}
+		if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+			log.Log.Fatalf("write ca cert error: %v", err)
+		}
+		fmt.Printf("ca certificate written to %s, private key to %s\n", certFile, keyFile)
+	},
+}
+
+var caExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write the CA certificate to stdout, to be trusted by clients",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ca, err := mitm.LoadCA(caFiles())
+		if err != nil {
+			log.Log.Fatalf("load ca error: %v", err)
+		}
+		switch caFormat {
+		case "pem":
+			os.Stdout.Write(ca.CertPEM())
+		case "der":
+			block, _ := pem.Decode(ca.CertPEM())
+			os.Stdout.Write(block.Bytes)
+		default:
+			log.Log.Fatalf("unknown format: %s", caFormat)
+		}
+	},
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/zzong12/hprotoxy/codec"
+)
+
+func init() {
+	rootCmd.AddCommand(codecsCmd)
+}
+
+var codecsCmd = &cobra.Command{
+	Use:   "codecs",
+	Short: "List available codecs and their parameters",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, m := range codec.List() {
+			symmetric := ""
+			if m.Symmetric {
+				symmetric = " (symmetric)"
+			}
+			fmt.Printf("%s: %s%s\n", m.Name, m.Description, symmetric)
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			for _, p := range m.Params {
+				typ := p.Type
+				if p.Required {
+					typ += ", required"
+				}
+				fmt.Fprintf(tw, "    %s\t%s\t%s\n", p.Name, typ, p.Desc)
+			}
+			tw.Flush()
+		}
+	},
+}
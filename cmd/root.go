@@ -24,15 +24,24 @@ var rootCmd = &cobra.Command{
 	Long:  ``,
 	Args:  cobra.MinimumNArgs(0),
 	Run: func(cmd *cobra.Command, args []string) {
-		cfg := new(server.Config)
-		if _, err := toml.DecodeFile(configFile, cfg); err != nil {
+		cfg, err := readConfig()
+		if err != nil {
 			log.Log.Fatalf("decode config file error: %v", err)
 		}
-		svr := server.NewServer(*cfg)
+		svr, err := server.NewServer(*cfg)
+		if err != nil {
+			log.Log.Fatalf("init server error: %v", err)
+		}
 		svr.Run()
 	},
 }
 
+func readConfig() (*server.Config, error) {
+	cfg := new(server.Config)
+	_, err := toml.DecodeFile(configFile, cfg)
+	return cfg, err
+}
+
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/zzong12/hprotoxy/codec"
+	"github.com/zzong12/hprotoxy/loader"
+	"github.com/zzong12/hprotoxy/log"
+	"github.com/zzong12/hprotoxy/server"
+)
+
+var (
+	tcChain      string
+	tcInput      string
+	tcOutput     string
+	tcInvert     bool
+	tcImportPath string
+	tcLoadFolder string
+)
+
+func init() {
+	for _, c := range []*cobra.Command{encodeCmd, decodeCmd} {
+		c.Flags().StringVarP(&tcChain, "chain", "c", "", "codec chain in ReqCodec syntax, or @profile")
+		c.Flags().StringVarP(&tcInput, "in", "i", "-", "input file, - for stdin")
+		c.Flags().StringVarP(&tcOutput, "out", "o", "-", "output file, - for stdout")
+		c.Flags().BoolVar(&tcInvert, "invert", false, "apply the chain in reverse order")
+		c.Flags().StringVar(&tcImportPath, "import-path", "", "import path of proto files, default is ImportPath of the config file")
+		c.Flags().StringVar(&tcLoadFolder, "load-folder", "", "folder of proto files to load, default is LoadFolder of the config file")
+		c.MarkFlagRequired("chain")
+		rootCmd.AddCommand(c)
+	}
+}
+
+var encodeCmd = &cobra.Command{
+	Use:   "encode",
+	Short: "Encode stdin or a file with a codec chain, like a request body",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runTranscode(true)
+	},
+}
+
+var decodeCmd = &cobra.Command{
+	Use:   "decode",
+	Short: "Decode stdin or a file with a codec chain, like a response body",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		runTranscode(false)
+	},
+}
+
+func runTranscode(encode bool) {
+	cfg, err := readConfig()
+	if err != nil {
+		// the default config file is optional offline, a given one is not
+		if !os.IsNotExist(err) || rootCmd.PersistentFlags().Changed("config") {
+			log.Log.Fatalf("decode config file error: %v", err)
+		}
+		cfg = new(server.Config)
+	}
+	if tcImportPath != "" {
+		cfg.ImportPath = tcImportPath
+	}
+	if tcLoadFolder != "" {
+		cfg.LoadFolder = tcLoadFolder
+		cfg.Sources = nil
+	}
+	opts := cfg.LoaderOptions()
+	opts.ReloadInterval, opts.Watch = 0, false
+	loader.InitLoader(opts)
+	sources, err := cfg.ReflectionSources()
+	if err != nil {
+		log.Log.Fatal(err)
+	}
+	for _, src := range sources {
+		loader.GetLocalLoader().AddReflectionSource(src)
+	}
+	if err := loader.GetLocalLoader().Load(); err != nil {
+		log.Log.WithError(err).Warn("no proto files loaded")
+	}
+
+	chain, err := server.ResolveChain(cfg.Profiles, tcChain, encode)
+	if err != nil {
+		log.Log.Fatal(err)
+	}
+	cs, err := codec.ParserCodes(chain)
+	if err != nil {
+		log.Log.Fatalf("invalid chain: %v", err)
+	}
+	if tcInvert {
+		cs = cs.Inverted()
+	}
+
+	in := os.Stdin
+	if tcInput != "-" {
+		if in, err = os.Open(tcInput); err != nil {
+			log.Log.Fatal(err)
+		}
+		defer in.Close()
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		log.Log.Fatalf("read input error: %v", err)
+	}
+
+	if encode {
+		data, err = cs.EncodeAll(data)
+	} else {
+		data, err = cs.DecodeAll(data)
+	}
+	if err != nil {
+		log.Log.Fatalf("transcode error: %v", err)
+	}
+
+	out := os.Stdout
+	if tcOutput != "-" {
+		if out, err = os.Create(tcOutput); err != nil {
+			log.Log.Fatal(err)
+		}
+		defer out.Close()
+	}
+	if _, err := out.Write(data); err != nil {
+		log.Log.Fatalf("write output error: %v", err)
+	}
+}
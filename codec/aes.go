@@ -1,64 +1,182 @@
 package codec
 
 import (
-	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
 )
 
+const (
+	aesModeCBC = "cbc"
+	aesModeECB = "ecb"
+	aesModeCTR = "ctr"
+	aesModeCFB = "cfb"
+	aesModeOFB = "ofb"
+)
+
+func init() {
+	Register("aes", func() Codec { return new(aesCodec) }, Meta{
+		Description: "AES encryption in CBC, ECB, CTR, CFB or OFB mode",
+		Params: []Param{
+			{Name: "key", Type: "key", Required: true, Desc: "16, 24 or 32 byte key"},
+			{Name: "iv", Type: "key", Desc: "16 byte initialization vector, required except in ecb mode"},
+			{Name: "mode", Type: "string", Desc: "cbc (default), ecb, ctr, cfb or ofb"},
+			{Name: "padding", Type: "string", Desc: "pkcs7, zero, iso10126 or none; default pkcs7 for cbc/ecb and none otherwise"},
+		},
+		Symmetric: true,
+	})
+}
+
 type aesCodec struct {
-	Key string `json:"key"`
-	Iv  string `json:"iv"`
+	Key     string `json:"key"`
+	Iv      string `json:"iv"`
+	Mode    string `json:"mode"`
+	Padding string `json:"padding"`
+
+	iv    []byte
+	block cipher.Block
 }
 
 func (c *aesCodec) Name() string {
 	return "aes"
 }
 
-func (c *aesCodec) Encode(data []byte) ([]byte, error) {
-	if 0 == len(data) {
-		return []byte{}, errors.New("AES/CBC/PKCS5PADDING encrypt failed, src empty")
+func (c *aesCodec) Init() error {
+	key, err := ResolveKey(c.Key)
+	if err != nil {
+		return err
+	}
+	if c.block, err = aes.NewCipher(key); err != nil {
+		return err
 	}
+	if c.iv, err = ResolveKey(c.Iv); err != nil {
+		return err
+	}
+	if c.Mode == "" {
+		c.Mode = aesModeCBC
+	}
+	switch c.Mode {
+	case aesModeCBC, aesModeECB:
+		if c.Padding == "" {
+			c.Padding = paddingPKCS7
+		}
+	case aesModeCTR, aesModeCFB, aesModeOFB:
+		if c.Padding == "" {
+			c.Padding = paddingNone
+		}
+	default:
+		return fmt.Errorf("unknown aes mode: %s", c.Mode)
+	}
+	if !validPadding(c.Padding) {
+		return fmt.Errorf("unknown padding: %s", c.Padding)
+	}
+	if c.Mode != aesModeECB && len(c.iv) != aes.BlockSize {
+		return fmt.Errorf("iv must be %d bytes, got %d", aes.BlockSize, len(c.iv))
+	}
+	return nil
+}
+
+func (c *aesCodec) desc() string {
+	return fmt.Sprintf("AES/%s/%s", strings.ToUpper(c.Mode), strings.ToUpper(c.Padding))
+}
+
+func (c *aesCodec) blockMode() bool {
+	return c.Mode == aesModeCBC || c.Mode == aesModeECB
+}
 
-	block, err := aes.NewCipher([]byte(c.Key))
+func (c *aesCodec) Encode(data []byte) ([]byte, error) {
+	if c.blockMode() && len(data) == 0 {
+		return []byte{}, errors.New(c.desc() + " encrypt failed, src empty")
+	}
+	content, err := pad(c.Padding, append([]byte{}, data...), aes.BlockSize)
 	if err != nil {
-		return []byte{}, err
+		return []byte{}, fmt.Errorf("%s encrypt failed, %v", c.desc(), err)
 	}
-
-	ecbEncoder := cipher.NewCBCEncrypter(block, []byte(c.Iv))
-	content := c.PKCS5_padding(data, block.BlockSize())
-	if len(content)%aes.BlockSize != 0 {
-		return []byte{}, errors.New("AES/CBC/PKCS5PADDING encrypt content not a multiple of the block size")
+	if c.blockMode() && len(content)%aes.BlockSize != 0 {
+		return []byte{}, errors.New(c.desc() + " encrypt failed, content not a multiple of the block size")
 	}
 
 	encrypted := make([]byte, len(content))
-	ecbEncoder.CryptBlocks(encrypted, content)
+	switch c.Mode {
+	case aesModeCBC:
+		cipher.NewCBCEncrypter(c.block, c.iv).CryptBlocks(encrypted, content)
+	case aesModeECB:
+		for i := 0; i < len(content); i += aes.BlockSize {
+			c.block.Encrypt(encrypted[i:], content[i:])
+		}
+	case aesModeCTR:
+		cipher.NewCTR(c.block, c.iv).XORKeyStream(encrypted, content)
+	case aesModeCFB:
+		cipher.NewCFBEncrypter(c.block, c.iv).XORKeyStream(encrypted, content)
+	case aesModeOFB:
+		cipher.NewOFB(c.block, c.iv).XORKeyStream(encrypted, content)
+	}
 	return encrypted, nil
 }
 
 func (c *aesCodec) Decode(data []byte) ([]byte, error) {
-	if 0 == len(data) {
-		return []byte{}, errors.New("AES/CBC/PKCS5PADDING decrypt failed, src empty")
+	if c.blockMode() {
+		if len(data) == 0 {
+			return []byte{}, errors.New(c.desc() + " decrypt failed, src empty")
+		}
+		if len(data)%aes.BlockSize != 0 {
+			return []byte{}, errors.New(c.desc() + " decrypt failed, src not a multiple of the block size")
+		}
 	}
-	block, err := aes.NewCipher([]byte(c.Key))
+
+	decrypted := make([]byte, len(data))
+	switch c.Mode {
+	case aesModeCBC:
+		cipher.NewCBCDecrypter(c.block, c.iv).CryptBlocks(decrypted, data)
+	case aesModeECB:
+		for i := 0; i < len(data); i += aes.BlockSize {
+			c.block.Decrypt(decrypted[i:], data[i:])
+		}
+	case aesModeCTR:
+		cipher.NewCTR(c.block, c.iv).XORKeyStream(decrypted, data)
+	case aesModeCFB:
+		cipher.NewCFBDecrypter(c.block, c.iv).XORKeyStream(decrypted, data)
+	case aesModeOFB:
+		cipher.NewOFB(c.block, c.iv).XORKeyStream(decrypted, data)
+	}
+
+	plain, err := unpad(c.Padding, decrypted, aes.BlockSize)
 	if err != nil {
-		return []byte{}, err
+		return []byte{}, fmt.Errorf("%s decrypt failed, %v", c.desc(), err)
 	}
-	ecbDecoder := cipher.NewCBCDecrypter(block, []byte(c.Iv))
-	decrypted := make([]byte, len(data))
-	ecbDecoder.CryptBlocks(decrypted, data)
+	return plain, nil
+}
 
-	return c.PKCS5_trimming(decrypted), nil
+// EncodeStream streams the ctr, cfb and ofb modes without padding.
+func (c *aesCodec) EncodeStream(r io.Reader) (io.Reader, error) {
+	return c.stream(r, true)
 }
 
-func (c *aesCodec) PKCS5_padding(cipherText []byte, blockSize int) []byte {
-	padding := blockSize - len(cipherText)%blockSize
-	padText := bytes.Repeat([]byte{byte(padding)}, padding)
-	return append(cipherText, padText...)
+func (c *aesCodec) DecodeStream(r io.Reader) (io.Reader, error) {
+	return c.stream(r, false)
 }
 
-func (c *aesCodec) PKCS5_trimming(encryptText []byte) []byte {
-	padding := encryptText[len(encryptText)-1]
-	return encryptText[:len(encryptText)-int(padding)]
+func (c *aesCodec) stream(r io.Reader, encrypt bool) (io.Reader, error) {
+	if c.Padding != paddingNone {
+		return nil, ErrNotStreamable
+	}
+	var s cipher.Stream
+	switch c.Mode {
+	case aesModeCTR:
+		s = cipher.NewCTR(c.block, c.iv)
+	case aesModeOFB:
+		s = cipher.NewOFB(c.block, c.iv)
+	case aesModeCFB:
+		if encrypt {
+			s = cipher.NewCFBEncrypter(c.block, c.iv)
+		} else {
+			s = cipher.NewCFBDecrypter(c.block, c.iv)
+		}
+	default:
+		return nil, ErrNotStreamable
+	}
+	return cipher.StreamReader{S: s, R: r}, nil
 }
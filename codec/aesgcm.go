@@ -0,0 +1,109 @@
+package codec
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+const (
+	nonceModeRandom = "random"
+	nonceModeFixed  = "fixed"
+)
+
+func init() {
+	Register("aesgcm", func() Codec { return new(aesGcmCodec) }, Meta{
+		Description: "AES-GCM authenticated encryption",
+		Params: []Param{
+			{Name: "key", Type: "key", Required: true, Desc: "16, 24 or 32 byte key"},
+			{Name: "nonceMode", Type: "string", Desc: "random (default, nonce prepended to ciphertext) or fixed"},
+			{Name: "nonce", Type: "key", Desc: "12 byte nonce, required when nonceMode is fixed"},
+			{Name: "tagSize", Type: "number", Desc: "authentication tag length in bytes, 12 to 16, default 16"},
+			{Name: "aad", Type: "key", Desc: "additional authenticated data"},
+		},
+		Symmetric: true,
+	})
+}
+
+type aesGcmCodec struct {
+	Key       string `json:"key"`
+	NonceMode string `json:"nonceMode"`
+	Nonce     string `json:"nonce"`
+	TagSize   int    `json:"tagSize"`
+	Aad       string `json:"aad"`
+
+	nonce []byte
+	aad   []byte
+	aead  cipher.AEAD
+}
+
+func (c *aesGcmCodec) Name() string {
+	return "aesgcm"
+}
+
+func (c *aesGcmCodec) Init() error {
+	key, err := ResolveKey(c.Key)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	if c.nonce, err = ResolveKey(c.Nonce); err != nil {
+		return err
+	}
+	if c.aad, err = ResolveKey(c.Aad); err != nil {
+		return err
+	}
+	if c.TagSize == 0 {
+		c.TagSize = 16
+	}
+	c.aead, err = cipher.NewGCMWithTagSize(block, c.TagSize)
+	if err != nil {
+		return err
+	}
+	switch c.NonceMode {
+	case "":
+		c.NonceMode = nonceModeRandom
+	case nonceModeRandom:
+	case nonceModeFixed:
+		if len(c.nonce) != c.aead.NonceSize() {
+			return fmt.Errorf("fixed nonce must be %d bytes, got %d", c.aead.NonceSize(), len(c.nonce))
+		}
+	default:
+		return fmt.Errorf("unknown nonce mode: %s", c.NonceMode)
+	}
+	return nil
+}
+
+func (c *aesGcmCodec) Encode(data []byte) ([]byte, error) {
+	if c.NonceMode == nonceModeFixed {
+		return c.aead.Seal(nil, c.nonce, data, c.aad), nil
+	}
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(data)+c.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("AES/GCM generate nonce failed: %v", err)
+	}
+	return c.aead.Seal(nonce, nonce, data, c.aad), nil
+}
+
+func (c *aesGcmCodec) Decode(data []byte) ([]byte, error) {
+	nonce := c.nonce
+	if c.NonceMode == nonceModeRandom {
+		if len(data) < c.aead.NonceSize() {
+			return nil, errors.New("AES/GCM decrypt failed, src shorter than nonce")
+		}
+		nonce, data = data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	}
+	if len(data) < c.aead.Overhead() {
+		return nil, errors.New("AES/GCM decrypt failed, src shorter than tag")
+	}
+	plain, err := c.aead.Open(nil, nonce, data, c.aad)
+	if err != nil {
+		return nil, errors.New("AES/GCM decrypt failed, authentication tag mismatch: ciphertext, nonce or aad was tampered with")
+	}
+	return plain, nil
+}
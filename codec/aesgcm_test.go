@@ -0,0 +1,116 @@
+package codec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const (
+	gcmKey   = `"key":"0123456789abcdef"`
+	gcmNonce = `"nonce":"hex:000102030405060708090a0b"`
+	gcmAad   = `"aad":"header"`
+)
+
+func TestAESGCMRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{"random nonce", `{` + gcmKey + `}`},
+		{"random nonce with aad", `{` + gcmKey + `,` + gcmAad + `}`},
+		{"fixed nonce", `{` + gcmKey + `,"nonceMode":"fixed",` + gcmNonce + `}`},
+		{"12 byte tag", `{` + gcmKey + `,"tagSize":12,` + gcmAad + `}`},
+		{"fixed nonce 12 byte tag", `{` + gcmKey + `,"nonceMode":"fixed",` + gcmNonce + `,"tagSize":12}`},
+	}
+	plain := []byte("hello aes-gcm")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := GenCodec("aesgcm", tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gcm := c.(*aesGcmCodec)
+			enc, err := c.Encode(plain)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantLen := len(plain) + gcm.TagSize
+			if gcm.NonceMode == nonceModeRandom {
+				wantLen += gcm.aead.NonceSize()
+			}
+			if len(enc) != wantLen {
+				t.Errorf("Encode = %d bytes, want %d", len(enc), wantLen)
+			}
+			dec, err := c.Decode(enc)
+			if err != nil || !bytes.Equal(dec, plain) {
+				t.Fatalf("Decode(Encode()) = %q, %v", dec, err)
+			}
+
+			again, _ := c.Encode(plain)
+			if fixed := gcm.NonceMode == nonceModeFixed; bytes.Equal(enc, again) != fixed {
+				t.Errorf("Encode twice gives equal output %v, want %v", !fixed, fixed)
+			}
+		})
+	}
+}
+
+func TestAESGCMTamper(t *testing.T) {
+	const tamperErr = "authentication tag mismatch"
+	flip := func(b []byte, i int) []byte {
+		b = append([]byte{}, b...)
+		b[i] ^= 1
+		return b
+	}
+
+	random, _ := GenCodec("aesgcm", `{`+gcmKey+`,`+gcmAad+`}`)
+	enc, err := random.Encode([]byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherAad, _ := GenCodec("aesgcm", `{`+gcmKey+`,"aad":"other"}`)
+
+	fixed, _ := GenCodec("aesgcm", `{`+gcmKey+`,"nonceMode":"fixed",`+gcmNonce+`}`)
+	fixedEnc, err := fixed.Encode([]byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherNonce, _ := GenCodec("aesgcm", `{`+gcmKey+`,"nonceMode":"fixed","nonce":"hex:000102030405060708090a0c"}`)
+
+	tests := []struct {
+		name    string
+		c       Codec
+		data    []byte
+		wantErr string
+	}{
+		{"nonce", random, flip(enc, 0), tamperErr},
+		{"ciphertext", random, flip(enc, 12), tamperErr},
+		{"tag", random, flip(enc, len(enc)-1), tamperErr},
+		{"aad", otherAad, enc, tamperErr},
+		{"fixed ciphertext", fixed, flip(fixedEnc, 0), tamperErr},
+		{"fixed nonce", otherNonce, fixedEnc, tamperErr},
+		{"shorter than nonce", random, enc[:11], "shorter than nonce"},
+		{"shorter than tag", fixed, fixedEnc[:15], "shorter than tag"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.c.Decode(tt.data); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Decode error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAESGCMSpec(t *testing.T) {
+	for _, spec := range []string{
+		`{"key":"short"}`,
+		`{` + gcmKey + `,"tagSize":11}`,
+		`{` + gcmKey + `,"nonceMode":"fixed"}`,
+		`{` + gcmKey + `,"nonceMode":"fixed","nonce":"short"}`,
+		`{` + gcmKey + `,"nonceMode":"counter"}`,
+	} {
+		if _, err := GenCodec("aesgcm", spec); err == nil {
+			t.Errorf("GenCodec(aesgcm, %s) succeeded", spec)
+		}
+	}
+}
@@ -1,6 +1,16 @@
 package codec
 
-import "encoding/base64"
+import (
+	"encoding/base64"
+	"io"
+)
+
+func init() {
+	Register("base64", func() Codec { return new(base64Codec) }, Meta{
+		Description: "standard base64 encoding",
+		Symmetric:   true,
+	})
+}
 
 type base64Codec struct {
 }
@@ -22,3 +32,11 @@ func (c *base64Codec) Decode(data []byte) ([]byte, error) {
 	}
 	return dst, nil
 }
+
+func (c *base64Codec) EncodeStream(r io.Reader) (io.Reader, error) {
+	return encodeChunks(r, func(w io.Writer) io.WriteCloser { return base64.NewEncoder(base64.StdEncoding, w) }), nil
+}
+
+func (c *base64Codec) DecodeStream(r io.Reader) (io.Reader, error) {
+	return base64.NewDecoder(base64.StdEncoding, r), nil
+}
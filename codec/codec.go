@@ -3,6 +3,7 @@ package codec
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 )
 
@@ -12,30 +13,85 @@ type Codec interface {
 	Decode(data []byte) ([]byte, error)
 }
 
+// Initializer is implemented by codecs that need to validate their spec or
+// prepare derived state once it has been unmarshaled.
+type Initializer interface {
+	Init() error
+}
+
+// Splitter is implemented by codecs whose data holds several elements. In
+// a decode chain the codecs after a splitter are applied to every element
+// and the results are joined into a JSON array; in an encode chain the
+// input is such a JSON array, the codecs before the splitter are applied to
+// every element and the results are joined by the splitter.
+type Splitter interface {
+	Split(data []byte) ([][]byte, error)
+	Join(elements [][]byte) ([]byte, error)
+}
+
+// Enveloper is implemented by codecs whose data carries trailers next to a
+// message, like grpcweb. When Enveloped, the codecs after it in a decode
+// chain are applied to the message and the result is an envelope
+// {"message":...,"trailers":{...}}; an encode chain takes such an envelope
+// and applies the codecs before it to the message.
+type Enveloper interface {
+	Enveloped() bool
+	Open(data []byte) (message []byte, trailers map[string]string, err error)
+	Seal(message []byte, trailers map[string]string) ([]byte, error)
+}
+
+// envelope is the JSON form of the data of an Enveloper. Message is
+// embedded like the elements of a Splitter, see joinElements.
+type envelope struct {
+	Message  json.RawMessage   `json:"message"`
+	Trailers map[string]string `json:"trailers,omitempty"`
+}
+
+// GenCodec builds the codec registered under name from its JSON spec.
 func GenCodec(name string, data string) (Codec, error) {
-	var cc Codec
-	switch name {
-	case "pb":
-		cc = new(protoCodec)
-	case "rc4":
-		cc = new(rc4Codec)
-	case "url":
-		cc = new(urlCodec)
-	case "base64":
-		cc = new(base64Codec)
-	case "aes":
-		cc = new(aesCodec)
-	case "gzip":
-		cc = new(gzipCodec)
-	default:
-		return nil, errors.New("not found codec")
+	return genCodec(name, data, true)
+}
+
+// genCodec is GenCodec; unless trusted, key params may not read the host's
+// environment or files, see checkClientKeys.
+func genCodec(name string, data string, trusted bool) (Codec, error) {
+	factory, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("not found codec: %s", name)
 	}
-	return cc, json.Unmarshal([]byte(data), cc)
+	if !trusted {
+		if err := checkClientKeys(name, data); err != nil {
+			return nil, err
+		}
+	}
+	cc := factory()
+	if err := json.Unmarshal([]byte(data), cc); err != nil {
+		return nil, fmt.Errorf("invalid %s codec spec: %v", name, err)
+	}
+	if in, ok := cc.(Initializer); ok {
+		if err := in.Init(); err != nil {
+			return nil, fmt.Errorf("invalid %s codec spec: %v", name, err)
+		}
+	}
+	return cc, nil
 }
 
 type Codecs []Codec
 
+// ParserCodes parses a codec chain from a trusted source, the config file or
+// the command line. Key params may use every form of ResolveKey.
 func ParserCodes(desc string) (Codecs, error) {
+	return parseCodecs(desc, true)
+}
+
+// ParserClientCodes parses a codec chain sent by a client, like the codec
+// headers of a proxied request. Key params may not use the env: and file:
+// forms, which would let clients use the host's secrets and files as keys.
+func ParserClientCodes(desc string) (Codecs, error) {
+	return parseCodecs(desc, false)
+}
+
+func parseCodecs(desc string, trusted bool) (Codecs, error) {
 	if len(desc) == 0 {
 		return nil, errors.New("empty codec desc")
 	}
@@ -46,10 +102,11 @@ func ParserCodes(desc string) (Codecs, error) {
 		}
 		idx := strings.Index(span, ":")
 		if idx == -1 {
+			return nil, fmt.Errorf("invalid codec span: %s", span)
 		}
 		name := span[:idx]
 		data := span[idx+1:]
-		c, err := GenCodec(name, data)
+		c, err := genCodec(name, data, trusted)
 		if err != nil {
 			return nil, err
 		}
@@ -66,19 +123,110 @@ func (cs Codecs) Inverted() Codecs {
 	return res
 }
 
+// splitter returns the index of the first (or with last the last) Splitter
+// in cs, or -1.
+func (cs Codecs) splitter(last bool) int {
+	return cs.find(last, func(c Codec) bool {
+		_, ok := c.(Splitter)
+		return ok
+	})
+}
+
+// boundary is like splitter but also finds Enveloped Envelopers, the codecs
+// that split a chain in the part run on the whole data and the part run on
+// its elements or message.
+func (cs Codecs) boundary(last bool) int {
+	return cs.find(last, func(c Codec) bool {
+		if env, ok := c.(Enveloper); ok && env.Enveloped() {
+			return true
+		}
+		_, ok := c.(Splitter)
+		return ok
+	})
+}
+
+func (cs Codecs) find(last bool, fn func(Codec) bool) int {
+	idx := -1
+	for i, c := range cs {
+		if fn(c) {
+			if !last {
+				return i
+			}
+			idx = i
+		}
+	}
+	return idx
+}
+
 func (cs Codecs) EncodeAll(data []byte) ([]byte, error) {
-	for _, c := range cs {
-		var err error
-		data, err = c.Encode(data)
+	k := cs.boundary(true)
+	if k < 0 {
+		for _, c := range cs {
+			var err error
+			data, err = c.Encode(data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	}
+
+	if sp, ok := cs[k].(Splitter); ok {
+		elements, err := splitElements(data)
 		if err != nil {
 			return nil, err
 		}
+		for i, e := range elements {
+			if elements[i], err = cs[:k].EncodeAll(e); err != nil {
+				return nil, fmt.Errorf("element %d: %v", i, err)
+			}
+		}
+		if data, err = sp.Join(elements); err != nil {
+			return nil, err
+		}
+	} else {
+		var env envelope
+		if err := json.Unmarshal(data, &env); err != nil || env.Message == nil {
+			return nil, errors.New(`want an envelope {"message":...,"trailers":{...}}`)
+		}
+		message, err := elementFromJSON(env.Message)
+		if err != nil {
+			return nil, fmt.Errorf("message: %v", err)
+		}
+		if message, err = cs[:k].EncodeAll(message); err != nil {
+			return nil, err
+		}
+		if data, err = cs[k].(Enveloper).Seal(message, env.Trailers); err != nil {
+			return nil, err
+		}
 	}
-	return data, nil
+	return cs[k+1:].EncodeAll(data)
 }
 
 func (cs Codecs) DecodeAll(data []byte) ([]byte, error) {
-	for _, c := range cs {
+	for i, c := range cs {
+		if sp, ok := c.(Splitter); ok {
+			elements, err := sp.Split(data)
+			if err != nil {
+				return nil, err
+			}
+			for j, e := range elements {
+				if elements[j], err = cs[i+1:].DecodeAll(e); err != nil {
+					return nil, fmt.Errorf("element %d: %v", j, err)
+				}
+			}
+			return joinElements(elements)
+		}
+		if env, ok := c.(Enveloper); ok && env.Enveloped() {
+			message, trailers, err := env.Open(data)
+			if err != nil {
+				return nil, err
+			}
+			if message, err = cs[i+1:].DecodeAll(message); err != nil {
+				return nil, err
+			}
+			return json.Marshal(envelope{Message: jsonElement(message), Trailers: trailers})
+		}
 		var err error
 		data, err = c.Decode(data)
 		if err != nil {
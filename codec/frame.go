@@ -0,0 +1,251 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	framePrefixVarint = "varint"
+	framePrefixU16BE  = "u16be"
+	framePrefixU32BE  = "u32be"
+	framePrefixU32LE  = "u32le"
+	framePrefixGRPC   = "grpc"
+)
+
+func init() {
+	Register("frame", func() Codec { return new(frameCodec) }, Meta{
+		Description: "length-prefixed messages <-> json array, the rest of the chain is applied to every message",
+		Params: []Param{
+			{Name: "prefix", Type: "string", Desc: "length prefix: varint (default), u16be, u32be, u32le or grpc (5 byte grpc frame header)"},
+		},
+		Symmetric: true,
+	})
+}
+
+// frameCodec splits a body of length-prefixed messages. It is a Splitter:
+// Codecs apply the codecs after it in a decode chain, or before it in an
+// encode chain, to every message.
+type frameCodec struct {
+	Prefix string `json:"prefix"`
+}
+
+func (c *frameCodec) Init() error {
+	switch c.Prefix {
+	case "":
+		c.Prefix = framePrefixVarint
+	case framePrefixVarint, framePrefixU16BE, framePrefixU32BE, framePrefixU32LE, framePrefixGRPC:
+	default:
+		return fmt.Errorf("unknown prefix %q", c.Prefix)
+	}
+	return nil
+}
+
+func (c *frameCodec) Name() string {
+	return "frame"
+}
+
+// Encode joins the elements of a JSON array, see splitElements.
+func (c *frameCodec) Encode(data []byte) ([]byte, error) {
+	elements, err := splitElements(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.Join(elements)
+}
+
+// Decode splits data into a JSON array, see joinElements.
+func (c *frameCodec) Decode(data []byte) ([]byte, error) {
+	elements, err := c.Split(data)
+	if err != nil {
+		return nil, err
+	}
+	return joinElements(elements)
+}
+
+func (c *frameCodec) Split(data []byte) ([][]byte, error) {
+	if c.Prefix == framePrefixGRPC {
+		frames, err := splitGRPCFrames(data)
+		if err != nil {
+			return nil, err
+		}
+		elements := make([][]byte, 0, len(frames))
+		for _, f := range frames {
+			if f.flag&grpcFlagTrailer != 0 {
+				continue
+			}
+			payload, err := framePayload(f)
+			if err != nil {
+				return nil, fmt.Errorf("message %d: %v", len(elements), err)
+			}
+			elements = append(elements, payload)
+		}
+		return elements, nil
+	}
+
+	var elements [][]byte
+	for len(data) > 0 {
+		size, n, err := c.readPrefix(data)
+		if err != nil {
+			return nil, fmt.Errorf("message %d: %v", len(elements), err)
+		}
+		if uint64(len(data)-n) < size {
+			return nil, fmt.Errorf("message %d: truncated, want %d bytes, got %d", len(elements), size, len(data)-n)
+		}
+		elements = append(elements, data[n:n+int(size)])
+		data = data[n+int(size):]
+	}
+	return elements, nil
+}
+
+func (c *frameCodec) Join(elements [][]byte) ([]byte, error) {
+	var out []byte
+	for _, e := range elements {
+		switch c.Prefix {
+		case framePrefixGRPC:
+			out = appendGRPCFrame(out, 0, e)
+			continue
+		case framePrefixU16BE:
+			if len(e) > 0xffff {
+				return nil, fmt.Errorf("message of %d bytes too large for a u16 prefix", len(e))
+			}
+			out = binary.BigEndian.AppendUint16(out, uint16(len(e)))
+		case framePrefixU32BE:
+			out = binary.BigEndian.AppendUint32(out, uint32(len(e)))
+		case framePrefixU32LE:
+			out = binary.LittleEndian.AppendUint32(out, uint32(len(e)))
+		default:
+			out = binary.AppendUvarint(out, uint64(len(e)))
+		}
+		out = append(out, e...)
+	}
+	return out, nil
+}
+
+// readElement reads the next message from r, io.EOF at the end of r.
+func (c *frameCodec) readElement(r *bufio.Reader) ([]byte, error) {
+	if c.Prefix == framePrefixGRPC {
+		for {
+			f, err := readGRPCFrame(r)
+			if err != nil {
+				return nil, err
+			}
+			if f.flag&grpcFlagTrailer == 0 {
+				return framePayload(f)
+			}
+		}
+	}
+	if _, err := r.Peek(1); err != nil {
+		return nil, err
+	}
+	var size uint64
+	var err error
+	switch c.Prefix {
+	case framePrefixU16BE:
+		var n uint16
+		err = binary.Read(r, binary.BigEndian, &n)
+		size = uint64(n)
+	case framePrefixU32BE, framePrefixU32LE:
+		var n uint32
+		if c.Prefix == framePrefixU32LE {
+			err = binary.Read(r, binary.LittleEndian, &n)
+		} else {
+			err = binary.Read(r, binary.BigEndian, &n)
+		}
+		size = uint64(n)
+	default:
+		size, err = binary.ReadUvarint(r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid length prefix: %v", noEOF(err))
+	}
+	if size > grpcWebMaxFrameSize {
+		return nil, fmt.Errorf("message too large: %d bytes", size)
+	}
+	e := make([]byte, size)
+	if _, err := io.ReadFull(r, e); err != nil {
+		return nil, fmt.Errorf("truncated message: %v", noEOF(err))
+	}
+	return e, nil
+}
+
+// readPrefix returns the message length at the start of data and the
+// length of the prefix.
+func (c *frameCodec) readPrefix(data []byte) (uint64, int, error) {
+	switch c.Prefix {
+	case framePrefixU16BE:
+		if len(data) < 2 {
+			return 0, 0, errors.New("truncated length prefix")
+		}
+		return uint64(binary.BigEndian.Uint16(data)), 2, nil
+	case framePrefixU32BE, framePrefixU32LE:
+		if len(data) < 4 {
+			return 0, 0, errors.New("truncated length prefix")
+		}
+		if c.Prefix == framePrefixU32LE {
+			return uint64(binary.LittleEndian.Uint32(data)), 4, nil
+		}
+		return uint64(binary.BigEndian.Uint32(data)), 4, nil
+	}
+	size, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0, errors.New("invalid varint length prefix")
+	}
+	return size, n, nil
+}
+
+// joinElements renders elements as a JSON array. Elements that are JSON
+// objects or arrays, like the output of pb, are embedded as is, others as
+// base64 strings.
+func joinElements(elements [][]byte) ([]byte, error) {
+	arr := make([]json.RawMessage, len(elements))
+	for i, e := range elements {
+		arr[i] = jsonElement(e)
+	}
+	return json.Marshal(arr)
+}
+
+func jsonElement(e []byte) json.RawMessage {
+	if t := bytes.TrimSpace(e); len(t) > 0 && (t[0] == '{' || t[0] == '[') && json.Valid(t) {
+		return e
+	}
+	b, _ := json.Marshal(base64.StdEncoding.EncodeToString(e))
+	return b
+}
+
+// splitElements is the inverse of joinElements.
+func splitElements(data []byte) ([][]byte, error) {
+	var arr []json.RawMessage
+	if err := json.Unmarshal(data, &arr); err != nil {
+		return nil, fmt.Errorf("want a json array of messages: %v", err)
+	}
+	elements := make([][]byte, len(arr))
+	for i, raw := range arr {
+		e, err := elementFromJSON(raw)
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %v", i, err)
+		}
+		elements[i] = e
+	}
+	return elements, nil
+}
+
+// elementFromJSON is the inverse of jsonElement: objects and arrays are
+// returned as is, strings are base64 decoded.
+func elementFromJSON(raw json.RawMessage) ([]byte, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) > 0 && (raw[0] == '{' || raw[0] == '[') {
+		return raw, nil
+	}
+	var str string
+	if len(raw) == 0 || raw[0] != '"' || json.Unmarshal(raw, &str) != nil {
+		return nil, errors.New("want a json object, array or base64 string")
+	}
+	return base64.StdEncoding.DecodeString(str)
+}
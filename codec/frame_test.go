@@ -0,0 +1,167 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+func TestFrameSplit(t *testing.T) {
+	gz := func(b []byte) []byte {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+		return buf.Bytes()
+	}
+	elements := [][]byte{[]byte("a"), {}, bytes.Repeat([]byte("b"), 300)}
+
+	tests := []struct {
+		prefix  string
+		data    []byte
+		want    [][]byte
+		wantErr bool
+	}{
+		{"varint", []byte{1, 'a', 0, 2, 'b', 'c'}, [][]byte{[]byte("a"), {}, []byte("bc")}, false},
+		{"u16be", []byte{0, 1, 'a', 0, 2, 'b', 'c'}, [][]byte{[]byte("a"), []byte("bc")}, false},
+		{"u32be", []byte{0, 0, 0, 1, 'a'}, [][]byte{[]byte("a")}, false},
+		{"u32le", []byte{1, 0, 0, 0, 'a'}, [][]byte{[]byte("a")}, false},
+		{"grpc", []byte{0, 0, 0, 0, 1, 'a', 0x80, 0, 0, 0, 1, 'x'}, [][]byte{[]byte("a")}, false},
+		{"grpc", append([]byte{1, 0, 0, 0, byte(len(gz([]byte("zip"))))}, gz([]byte("zip"))...), [][]byte{[]byte("zip")}, false},
+		{"varint", nil, nil, false},
+		{"varint", []byte{5, 'a'}, nil, true},
+		{"varint", []byte{0x80}, nil, true},
+		{"u16be", []byte{0}, nil, true},
+		{"u32be", []byte{0, 0, 0, 2, 'a'}, nil, true},
+		{"grpc", []byte{0, 0, 0}, nil, true},
+		{"grpc", []byte{1, 0, 0, 0, 1, 'a'}, nil, true},
+	}
+	for _, tt := range tests {
+		c := &frameCodec{Prefix: tt.prefix}
+		if err := c.Init(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := c.Split(tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: Split(%x) error = %v, wantErr %v", tt.prefix, tt.data, err, tt.wantErr)
+			continue
+		}
+		if !equalElements(got, tt.want) {
+			t.Errorf("%s: Split(%x) = %q, want %q", tt.prefix, tt.data, got, tt.want)
+		}
+
+		// readElement, used when streaming, agrees with Split
+		streamed, err := io.ReadAll(decodeElements(bytes.NewReader(tt.data), c, nil))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: streamed split of %x error = %v, wantErr %v", tt.prefix, tt.data, err, tt.wantErr)
+		}
+		if want, _ := joinElements(tt.want); !tt.wantErr && !bytes.Equal(streamed, want) {
+			t.Errorf("%s: streamed split of %x = %s, want %s", tt.prefix, tt.data, streamed, want)
+		}
+	}
+
+	for _, prefix := range []string{"varint", "u16be", "u32be", "u32le", "grpc"} {
+		c := &frameCodec{Prefix: prefix}
+		joined, err := c.Join(elements)
+		if err != nil {
+			t.Fatalf("%s: Join: %v", prefix, err)
+		}
+		got, err := c.Split(joined)
+		if err != nil || !equalElements(got, elements) {
+			t.Errorf("%s: Split(Join()) = %q, %v", prefix, got, err)
+		}
+	}
+
+	if _, err := (&frameCodec{Prefix: "u16be"}).Join([][]byte{make([]byte, 0x10000)}); err == nil {
+		t.Errorf("u16be: Join of a 64KB message succeeded")
+	}
+	if err := (&frameCodec{Prefix: "nope"}).Init(); err == nil {
+		t.Errorf("unknown prefix accepted")
+	}
+}
+
+func TestFrameElements(t *testing.T) {
+	tests := []struct {
+		name    string
+		element []byte
+		json    string
+	}{
+		{"object", []byte(`{"a":1}`), `[{"a":1}]`},
+		{"array", []byte(`[1,2]`), `[[1,2]]`},
+		{"binary", []byte{0xff, 0}, `["/wA="]`},
+		{"json string", []byte(`"abc"`), `["ImFiYyI="]`},
+		{"json number", []byte(`12`), `["MTI="]`},
+		{"empty", []byte{}, `[""]`},
+	}
+	c, err := GenCodec("frame", "{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := c.(Splitter).Join([][]byte{tt.element})
+			got, err := c.Decode(data)
+			if err != nil || string(got) != tt.json {
+				t.Fatalf("Decode = %s, %v, want %s", got, err, tt.json)
+			}
+			back, err := c.Encode(got)
+			if err != nil || !bytes.Equal(back, data) {
+				t.Errorf("Encode(%s) = %x, %v, want %x", got, back, err, data)
+			}
+		})
+	}
+
+	for _, bad := range []string{`{}`, `[1]`, `["!!"]`, `[null]`} {
+		if _, err := c.Encode([]byte(bad)); err == nil {
+			t.Errorf("Encode(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestFrameChain(t *testing.T) {
+	cs, err := ParserCodes(`base64:{};frame:{"prefix":"u32be"};gzip:{}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in := []byte(`["aGVsbG8=","d29ybGQ="]`)
+	enc, err := cs.EncodeAll(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec, err := cs.Inverted().DecodeAll(enc)
+	if err != nil || !bytes.Equal(dec, in) {
+		t.Fatalf("DecodeAll(EncodeAll(%s)) = %s, %v", in, dec, err)
+	}
+
+	r, err := cs.EncodeStream(bytes.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	streamed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec, err := cs.Inverted().DecodeAll(streamed); err != nil || !bytes.Equal(dec, in) {
+		t.Errorf("DecodeAll(EncodeStream(%s)) = %s, %v", in, dec, err)
+	}
+	r, err = cs.Inverted().DecodeStream(bytes.NewReader(enc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dec, err := io.ReadAll(r); err != nil || !bytes.Equal(dec, in) {
+		t.Errorf("DecodeStream(EncodeAll(%s)) = %s, %v", in, dec, err)
+	}
+}
+
+func equalElements(a, b [][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,327 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	grpcFrameHeaderLen  = 5
+	grpcFlagCompressed  = 0x01
+	grpcFlagTrailer     = 0x80
+	grpcStatusHeader    = "grpc-status"
+	grpcMessageHeader   = "grpc-message"
+	grpcWebTextQuantum  = 4
+	grpcWebMaxFrameSize = 64 << 20
+)
+
+func init() {
+	params := []Param{
+		{Name: "trailers", Type: "object", Desc: "trailers written in a trailer frame after the data, e.g. {\"grpc-status\":\"0\"}"},
+		{Name: "checkStatus", Type: "bool", Desc: "fail decoding when the trailers carry a non-zero grpc-status"},
+		{Name: "compress", Type: "bool", Desc: "gzip the data frame"},
+		{Name: "envelope", Type: "bool", Desc: "decode to {\"message\":...,\"trailers\":{...}}, the rest of the chain is applied to the message, and encode from it"},
+	}
+	Register("grpcweb", func() Codec { return new(grpcWebCodec) }, Meta{
+		Description: "gRPC-Web (application/grpc-web+proto) data and trailer frames",
+		Params:      params,
+		Symmetric:   true,
+	})
+	Register("grpcwebtext", func() Codec { return &grpcWebCodec{text: true} }, Meta{
+		Description: "gRPC-Web text (application/grpc-web-text), base64 encoded frames",
+		Params:      params,
+		Symmetric:   true,
+	})
+}
+
+type grpcWebCodec struct {
+	Trailers    map[string]string `json:"trailers"`
+	CheckStatus bool              `json:"checkStatus"`
+	Compress    bool              `json:"compress"`
+	Envelope    bool              `json:"envelope"`
+
+	text bool
+}
+
+type grpcFrame struct {
+	flag    byte
+	payload []byte
+}
+
+func (c *grpcWebCodec) Name() string {
+	if c.text {
+		return "grpcwebtext"
+	}
+	return "grpcweb"
+}
+
+// Encode wraps data in a data frame, followed by a trailer frame when
+// trailers are set.
+func (c *grpcWebCodec) Encode(data []byte) ([]byte, error) {
+	return c.Seal(data, nil)
+}
+
+// Decode returns the payload of the data frame. Trailer frames are only
+// looked at with checkStatus.
+func (c *grpcWebCodec) Decode(data []byte) ([]byte, error) {
+	message, _, err := c.Open(data)
+	return message, err
+}
+
+func (c *grpcWebCodec) Enveloped() bool {
+	return c.Envelope
+}
+
+// Seal is Encode with the given trailers, or those of the spec if nil.
+func (c *grpcWebCodec) Seal(message []byte, trailers map[string]string) ([]byte, error) {
+	if trailers == nil {
+		trailers = c.Trailers
+	}
+	var flag byte
+	if c.Compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(message)
+		gz.Close()
+		message, flag = buf.Bytes(), grpcFlagCompressed
+	}
+	out := appendGRPCFrame(nil, flag, message)
+	if len(trailers) > 0 {
+		out = appendGRPCFrame(out, grpcFlagTrailer, formatTrailers(trailers))
+	}
+	if c.text {
+		return []byte(base64.StdEncoding.EncodeToString(out)), nil
+	}
+	return out, nil
+}
+
+// Open returns the payload of the data frame and the trailers. A body of
+// several data frames, as a server stream returns, is an error: the
+// messages would be merged, frame:{"prefix":"grpc"} splits them.
+func (c *grpcWebCodec) Open(data []byte) ([]byte, map[string]string, error) {
+	if c.text {
+		var err error
+		if data, err = decodeGRPCWebText(data); err != nil {
+			return nil, nil, err
+		}
+	}
+	frames, err := splitGRPCFrames(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	var message []byte
+	var trailers map[string]string
+	dataFrames := 0
+	for _, f := range frames {
+		if f.flag&grpcFlagTrailer != 0 {
+			if trailers == nil {
+				trailers = make(map[string]string)
+			}
+			parseTrailers(f.payload, trailers)
+			continue
+		}
+		if dataFrames++; dataFrames > 1 {
+			return nil, nil, errGRPCStream
+		}
+		if message, err = framePayload(f); err != nil {
+			return nil, nil, err
+		}
+	}
+	if c.CheckStatus {
+		if err := checkTrailers(trailers); err != nil {
+			return nil, nil, err
+		}
+	}
+	return message, trailers, nil
+}
+
+var errGRPCStream = errors.New(`grpc-web body holds several messages, use frame:{"prefix":"grpc"} to split them`)
+
+// EncodeStream returns ErrNotStreamable: a data frame starts with the
+// length of the whole message.
+func (c *grpcWebCodec) EncodeStream(r io.Reader) (io.Reader, error) {
+	return nil, ErrNotStreamable
+}
+
+// DecodeStream returns the payload of the data frame as it is read. With
+// envelope the trailers are needed first, so it can't stream.
+func (c *grpcWebCodec) DecodeStream(r io.Reader) (io.Reader, error) {
+	if c.Envelope {
+		return nil, ErrNotStreamable
+	}
+	if c.text {
+		r = grpcWebTextReader(r)
+	}
+	dataFrames := 0
+	return &chunkReader{next: func(buf *bytes.Buffer) error {
+		f, err := readGRPCFrame(r)
+		if err != nil {
+			return err
+		}
+		if f.flag&grpcFlagTrailer != 0 {
+			if c.CheckStatus {
+				trailers := make(map[string]string)
+				parseTrailers(f.payload, trailers)
+				return checkTrailers(trailers)
+			}
+			return nil
+		}
+		if dataFrames++; dataFrames > 1 {
+			return errGRPCStream
+		}
+		payload, err := framePayload(f)
+		buf.Write(payload)
+		return err
+	}}, nil
+}
+
+// framePayload returns the payload of a data frame, gunzipped if flagged as
+// compressed.
+func framePayload(f grpcFrame) ([]byte, error) {
+	if f.flag&grpcFlagCompressed == 0 {
+		return f.payload, nil
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(f.payload))
+	if err != nil {
+		return nil, fmt.Errorf("compressed grpc frame: %v", err)
+	}
+	payload, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("compressed grpc frame: %v", err)
+	}
+	return payload, nil
+}
+
+func appendGRPCFrame(out []byte, flag byte, payload []byte) []byte {
+	var header [grpcFrameHeaderLen]byte
+	header[0] = flag
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload)))
+	out = append(out, header[:]...)
+	return append(out, payload...)
+}
+
+// splitGRPCFrames splits data into length-prefixed gRPC frames.
+func splitGRPCFrames(data []byte) ([]grpcFrame, error) {
+	var frames []grpcFrame
+	for len(data) > 0 {
+		if len(data) < grpcFrameHeaderLen {
+			return nil, fmt.Errorf("truncated grpc frame header: %d bytes", len(data))
+		}
+		size := binary.BigEndian.Uint32(data[1:grpcFrameHeaderLen])
+		if size > grpcWebMaxFrameSize {
+			return nil, fmt.Errorf("grpc frame too large: %d bytes", size)
+		}
+		if uint32(len(data)-grpcFrameHeaderLen) < size {
+			return nil, fmt.Errorf("truncated grpc frame: want %d bytes, got %d", size, len(data)-grpcFrameHeaderLen)
+		}
+		end := grpcFrameHeaderLen + int(size)
+		frames = append(frames, grpcFrame{flag: data[0], payload: data[grpcFrameHeaderLen:end]})
+		data = data[end:]
+	}
+	return frames, nil
+}
+
+// readGRPCFrame reads the next frame of r, io.EOF at the end of r.
+func readGRPCFrame(r io.Reader) (grpcFrame, error) {
+	var header [grpcFrameHeaderLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return grpcFrame{}, fmt.Errorf("truncated grpc frame header: %v", err)
+		}
+		return grpcFrame{}, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > grpcWebMaxFrameSize {
+		return grpcFrame{}, fmt.Errorf("grpc frame too large: %d bytes", size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err = noEOF(err); err == io.ErrUnexpectedEOF {
+			return grpcFrame{}, fmt.Errorf("truncated grpc frame: %v", err)
+		}
+		return grpcFrame{}, err
+	}
+	return grpcFrame{flag: header[0], payload: payload}, nil
+}
+
+// grpcWebTextReader decodes a grpc-web-text body as it is read, see
+// decodeGRPCWebText.
+func grpcWebTextReader(r io.Reader) io.Reader {
+	var pending []byte
+	src := make([]byte, streamChunkSize)
+	return &chunkReader{next: func(buf *bytes.Buffer) error {
+		n, err := r.Read(src)
+		pending = append(pending, bytes.Join(bytes.Fields(src[:n]), nil)...)
+		full := len(pending) - len(pending)%grpcWebTextQuantum
+		if err == io.EOF {
+			full = len(pending)
+		} else if err != nil {
+			return err
+		}
+		out, derr := decodeGRPCWebText(pending[:full])
+		if derr != nil {
+			return derr
+		}
+		buf.Write(out)
+		pending = append(pending[:0], pending[full:]...)
+		return err
+	}}
+}
+
+// decodeGRPCWebText decodes a grpc-web-text body. Servers may base64 encode
+// every frame on its own, so padding can occur in the middle of the body;
+// decoding each 4 byte quantum separately handles both.
+func decodeGRPCWebText(data []byte) ([]byte, error) {
+	data = bytes.Join(bytes.Fields(data), nil)
+	if len(data)%grpcWebTextQuantum != 0 {
+		return nil, errors.New("invalid grpc-web-text body: length is not a multiple of 4")
+	}
+	out := make([]byte, 0, len(data)/grpcWebTextQuantum*3)
+	buf := make([]byte, 3)
+	for i := 0; i < len(data); i += grpcWebTextQuantum {
+		n, err := base64.StdEncoding.Decode(buf, data[i:i+grpcWebTextQuantum])
+		if err != nil {
+			return nil, fmt.Errorf("invalid grpc-web-text body: %v", err)
+		}
+		out = append(out, buf[:n]...)
+	}
+	return out, nil
+}
+
+func formatTrailers(trailers map[string]string) []byte {
+	keys := make([]string, 0, len(trailers))
+	for k := range trailers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "%s: %s\r\n", strings.ToLower(k), trailers[k])
+	}
+	return []byte(sb.String())
+}
+
+// parseTrailers adds the "key: value" lines of a trailer frame to
+// trailers, with lower case keys.
+func parseTrailers(payload []byte, trailers map[string]string) {
+	for _, line := range strings.Split(string(payload), "\r\n") {
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			trailers[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+}
+
+// checkTrailers returns an error for a non-zero grpc-status.
+func checkTrailers(trailers map[string]string) error {
+	if st := trailers[grpcStatusHeader]; st != "" && st != "0" {
+		return fmt.Errorf("grpc status %s: %s", st, trailers[grpcMessageHeader])
+	}
+	return nil
+}
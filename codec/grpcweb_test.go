@@ -0,0 +1,171 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGRPCWebDecode(t *testing.T) {
+	data := func(p string) []byte { return appendGRPCFrame(nil, 0, []byte(p)) }
+	trailer := func(p string) []byte { return appendGRPCFrame(nil, grpcFlagTrailer, []byte(p)) }
+	join := func(frames ...[]byte) []byte { return bytes.Join(frames, nil) }
+
+	tests := []struct {
+		name    string
+		spec    string
+		body    []byte
+		want    string
+		wantErr string
+	}{
+		{"data", `{}`, data("msg"), "msg", ""},
+		{"data and trailers", `{}`, join(data("msg"), trailer("grpc-status: 0\r\n")), "msg", ""},
+		{"trailers only", `{}`, trailer("grpc-status: 0\r\n"), "", ""},
+		{"error status ignored", `{}`, join(data("msg"), trailer("grpc-status: 5\r\n")), "msg", ""},
+		{"error status", `{"checkStatus":true}`, join(data("msg"), trailer("grpc-status: 5\r\ngrpc-message: gone\r\n")), "", "grpc status 5: gone"},
+		{"two messages", `{}`, join(data("a"), data("b")), "", "frame:"},
+		{"truncated header", `{}`, []byte{0, 0}, "", "truncated"},
+		{"truncated frame", `{}`, data("msg")[:6], "", "truncated"},
+		{"compressed", `{}`, mustEncode(t, `{"compress":true}`, "zipped"), "zipped", ""},
+		{"envelope", `{"envelope":true}`, join(data(`{"a":1}`), trailer("Grpc-Status: 0\r\nx-id: 7\r\n")),
+			`{"message":{"a":1},"trailers":{"grpc-status":"0","x-id":"7"}}`, ""},
+		{"envelope binary", `{"envelope":true}`, data("\xff"), `{"message":"/w=="}`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs, err := ParserCodes("grpcweb:" + tt.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := cs.DecodeAll(tt.body)
+			checkResult(t, "DecodeAll", got, err, tt.want, tt.wantErr)
+
+			if strings.Contains(tt.spec, "envelope") {
+				return
+			}
+			r, err := cs.DecodeStream(bytes.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = io.ReadAll(r)
+			checkResult(t, "DecodeStream", got, err, tt.want, tt.wantErr)
+		})
+	}
+}
+
+func TestGRPCWebText(t *testing.T) {
+	c, _ := GenCodec("grpcwebtext", `{"trailers":{"grpc-status":"0"}}`)
+	enc, err := c.Encode([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// servers may encode every frame on its own, with padding in between
+	frames, _ := splitGRPCFrames(mustDecodeBase64(t, string(enc)))
+	var perFrame string
+	for _, f := range frames {
+		perFrame += base64.StdEncoding.EncodeToString(appendGRPCFrame(nil, f.flag, f.payload)) + "\n"
+	}
+
+	for _, body := range []string{string(enc), perFrame} {
+		got, err := c.Decode([]byte(body))
+		if err != nil || string(got) != "hello" {
+			t.Errorf("Decode(%q) = %q, %v", body, got, err)
+		}
+		r, _ := c.(StreamCodec).DecodeStream(&oneByteReader{strings.NewReader(body)})
+		got, err = io.ReadAll(r)
+		if err != nil || string(got) != "hello" {
+			t.Errorf("DecodeStream(%q) = %q, %v", body, got, err)
+		}
+	}
+	if _, err := c.Decode([]byte("abc")); err == nil {
+		t.Errorf("Decode of a partial quantum succeeded")
+	}
+}
+
+func TestGRPCWebEnvelopeEncode(t *testing.T) {
+	cs, err := ParserCodes(`grpcweb:{"envelope":true,"trailers":{"grpc-status":"1"}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in           string
+		wantMessage  string
+		wantTrailers map[string]string
+	}{
+		{`{"message":{"a":1},"trailers":{"grpc-status":"0","x-id":"7"}}`, `{"a":1}`, map[string]string{"grpc-status": "0", "x-id": "7"}},
+		{`{"message":"aGk="}`, "hi", map[string]string{"grpc-status": "1"}},
+	}
+	for _, tt := range tests {
+		enc, err := cs.EncodeAll([]byte(tt.in))
+		if err != nil {
+			t.Fatalf("EncodeAll(%s): %v", tt.in, err)
+		}
+		message, trailers, err := cs[0].(Enveloper).Open(enc)
+		if err != nil || string(message) != tt.wantMessage || !reflect.DeepEqual(trailers, tt.wantTrailers) {
+			t.Errorf("Open(EncodeAll(%s)) = %q, %v, %v", tt.in, message, trailers, err)
+		}
+	}
+	for _, bad := range []string{`{}`, `[]`, `{"message":1}`} {
+		if _, err := cs.EncodeAll([]byte(bad)); err == nil {
+			t.Errorf("EncodeAll(%s) succeeded", bad)
+		}
+	}
+}
+
+func checkResult(t *testing.T, what string, got []byte, err error, want, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s error = %v, want %q", what, err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("%s: %v", what, err)
+	}
+	if json.Valid([]byte(want)) && json.Valid(got) {
+		var a, b interface{}
+		json.Unmarshal(got, &a)
+		json.Unmarshal([]byte(want), &b)
+		if !reflect.DeepEqual(a, b) {
+			t.Errorf("%s = %s, want %s", what, got, want)
+		}
+		return
+	}
+	if string(got) != want {
+		t.Errorf("%s = %q, want %q", what, got, want)
+	}
+}
+
+func mustEncode(t *testing.T, spec, data string) []byte {
+	c, err := GenCodec("grpcweb", spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := c.Encode([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func mustDecodeBase64(t *testing.T, s string) []byte {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+type oneByteReader struct{ r io.Reader }
+
+func (o *oneByteReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return o.r.Read(p[:1])
+}
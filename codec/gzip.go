@@ -3,8 +3,16 @@ package codec
 import (
 	"bytes"
 	"compress/gzip"
+	"io"
 )
 
+func init() {
+	Register("gzip", func() Codec { return new(gzipCodec) }, Meta{
+		Description: "gzip compression",
+		Symmetric:   true,
+	})
+}
+
 type gzipCodec struct {
 }
 
@@ -30,3 +38,11 @@ func (c *gzipCodec) Decode(data []byte) ([]byte, error) {
 	buf.ReadFrom(gz)
 	return buf.Bytes(), nil
 }
+
+func (c *gzipCodec) EncodeStream(r io.Reader) (io.Reader, error) {
+	return encodeChunks(r, func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) }), nil
+}
+
+func (c *gzipCodec) DecodeStream(r io.Reader) (io.Reader, error) {
+	return &lazyReader{open: func() (io.Reader, error) { return gzip.NewReader(r) }}, nil
+}
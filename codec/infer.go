@@ -0,0 +1,176 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/zzong12/hprotoxy/loader"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+const (
+	// inferType as the res of a pb codec decodes with the message type
+	// that best fits the data.
+	inferType = "*"
+	// inferAlternatives is the number of runner-up types reported.
+	inferAlternatives = 3
+)
+
+type (
+	inferCandidate struct {
+		Type       string  `json:"type"`
+		Confidence float64 `json:"confidence"`
+
+		msg   *dynamic.Message
+		good  int
+		unset int
+	}
+
+	inferResult struct {
+		Type         string            `json:"type"`
+		Confidence   float64           `json:"confidence"`
+		Message      json.RawMessage   `json:"message"`
+		Alternatives []*inferCandidate `json:"alternatives"`
+	}
+)
+
+// candidateDescriptors returns the message types named by patterns, where a
+// trailing ".*" matches a package prefix, or by default the types of the
+// files loaded from sources, leaving out the well-known types and other
+// files that are only dependencies.
+func candidateDescriptors(registry *loader.Registry, patterns []string) []*desc.MessageDescriptor {
+	all := registry.ListMessageDescriptors()
+	var res []*desc.MessageDescriptor
+	for _, md := range all {
+		if len(patterns) == 0 {
+			fd := md.GetFile()
+			if registry.HasSource(fd) && !strings.HasPrefix(fd.GetName(), "google/protobuf/") {
+				res = append(res, md)
+			}
+			continue
+		}
+		name := md.GetFullyQualifiedName()
+		for _, p := range patterns {
+			if name == p || (strings.HasSuffix(p, ".*") && strings.HasPrefix(name, p[:len(p)-1])) {
+				res = append(res, md)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// scoreMessage counts the fields of msg that look right (good) and wrong
+// (bad): unknown fields, invalid UTF-8 strings and undefined enum values.
+func scoreMessage(msg *dynamic.Message) (good, bad int) {
+	for _, tag := range msg.GetUnknownFields() {
+		bad += len(msg.GetUnknownField(tag))
+	}
+	for _, fd := range msg.GetMessageDescriptor().GetFields() {
+		if !msg.HasField(fd) {
+			continue
+		}
+		var values []interface{}
+		switch v := msg.GetField(fd).(type) {
+		case []interface{}:
+			values = v
+		case map[interface{}]interface{}:
+			for k, e := range v {
+				values = append(values, k, e)
+			}
+		default:
+			values = []interface{}{v}
+		}
+		for _, v := range values {
+			g, b := scoreValue(fd, v)
+			good += g
+			bad += b
+		}
+	}
+	return good, bad
+}
+
+func scoreValue(fd *desc.FieldDescriptor, v interface{}) (good, bad int) {
+	switch v := v.(type) {
+	case *dynamic.Message:
+		g, b := scoreMessage(v)
+		return g + 1, b
+	case string:
+		if !utf8.ValidString(v) {
+			return 0, 1
+		}
+	case int32:
+		if fd.GetType() == descriptorpb.FieldDescriptorProto_TYPE_ENUM && fd.GetEnumType().FindValueByNumber(v) == nil {
+			return 0, 1
+		}
+	}
+	return 1, 0
+}
+
+// inferMessage decodes data with every candidate type and returns them
+// ordered from the best fit: highest confidence, then most matched fields,
+// then fewest declared fields left unset.
+func inferMessage(data []byte, mds []*desc.MessageDescriptor) []*inferCandidate {
+	var res []*inferCandidate
+	for _, md := range mds {
+		msg := dynamic.NewMessage(md)
+		if err := msg.Unmarshal(data); err != nil {
+			continue
+		}
+		good, bad := scoreMessage(msg)
+		c := &inferCandidate{Type: md.GetFullyQualifiedName(), msg: msg, good: good}
+		for _, fd := range md.GetFields() {
+			if !msg.HasField(fd) {
+				c.unset++
+			}
+		}
+		if good+bad > 0 {
+			c.Confidence = float64(good) / float64(good+bad)
+		}
+		res = append(res, c)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Confidence != res[j].Confidence {
+			return res[i].Confidence > res[j].Confidence
+		}
+		if res[i].good != res[j].good {
+			return res[i].good > res[j].good
+		}
+		if res[i].unset != res[j].unset {
+			return res[i].unset < res[j].unset
+		}
+		return res[i].Type < res[j].Type
+	})
+	return res
+}
+
+func (c *protoCodec) decodeInfer(data []byte) ([]byte, error) {
+	registry, err := c.registry()
+	if err != nil {
+		return nil, err
+	}
+	candidates := inferMessage(data, candidateDescriptors(registry, c.Candidates))
+	if len(candidates) == 0 {
+		return nil, errors.New("no message type matches the data")
+	}
+	best := candidates[0]
+	body, err := marshalMessage(best.msg)
+	if err != nil {
+		return nil, err
+	}
+	res := &inferResult{
+		Type:         best.Type,
+		Confidence:   best.Confidence,
+		Message:      body,
+		Alternatives: candidates[1:],
+	}
+	if len(res.Alternatives) > inferAlternatives {
+		res.Alternatives = res.Alternatives[:inferAlternatives]
+	}
+	return json.Marshal(res)
+}
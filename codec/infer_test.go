@@ -0,0 +1,84 @@
+package codec
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zzong12/hprotoxy/loader"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// loadTestSchema loads proto into the local loader.
+func loadTestSchema(t *testing.T, proto string) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "test.proto"), []byte(proto), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loader.InitLoader(loader.Options{ImportPaths: []string{dir}, Roots: []loader.Root{{Path: dir}}})
+	if err := loader.GetLocalLoader().Load(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInferCandidates(t *testing.T) {
+	// test.User, a string and a varint, fits several messages of the
+	// imported descriptor.proto just as well.
+	loadTestSchema(t, `
+syntax = "proto3";
+package test;
+import "google/protobuf/descriptor.proto";
+
+message User {
+	string name = 1;
+	int32 age = 2;
+}
+message Other {
+	fixed64 id = 1;
+	repeated int64 tags = 3;
+}
+message Holder {
+	google.protobuf.FileDescriptorProto file = 1;
+}
+`)
+	data := protowire.AppendString(protowire.AppendTag(nil, 1, protowire.BytesType), "bob")
+	data = protowire.AppendVarint(protowire.AppendTag(data, 2, protowire.VarintType), 1)
+
+	tests := []struct {
+		name       string
+		candidates string
+		want       string
+	}{
+		{"default", ``, "test.User"},
+		{"package", `,"candidates":["test.*"]`, "test.User"},
+		{"named well-known type", `,"candidates":["google.protobuf.UninterpretedOption.NamePart"]`, "google.protobuf.UninterpretedOption.NamePart"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := GenCodec("pb", `{"res":"*"`+tt.candidates+`}`)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := c.Decode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var res inferResult
+			if err := json.Unmarshal(out, &res); err != nil {
+				t.Fatal(err)
+			}
+			if res.Type != tt.want {
+				t.Fatalf("inferred %s, want %s: %s", res.Type, tt.want, out)
+			}
+			for _, alt := range res.Alternatives {
+				if tt.candidates == "" && alt.Type != "test.Other" && alt.Type != "test.Holder" {
+					t.Errorf("alternative %s is not a type of test.proto", alt.Type)
+				}
+				if alt.Confidence > res.Confidence {
+					t.Errorf("alternative %s scores %v over %v", alt.Type, alt.Confidence, res.Confidence)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ResolveKey turns key material from a codec spec into bytes. The value may
+// be given as "hex:<hex>", "base64:<std base64>", "env:<NAME>" or
+// "file:<path>"; anything else is used as raw bytes. The value of an
+// environment variable may itself use the hex: or base64: form, a file is
+// read as-is. Chains sent by clients may not use env: and file:, see
+// ParserClientCodes.
+func ResolveKey(s string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(s, "hex:"):
+		key, err := hex.DecodeString(s[len("hex:"):])
+		if err != nil {
+			return nil, fmt.Errorf("invalid hex key: %v", err)
+		}
+		return key, nil
+	case strings.HasPrefix(s, "base64:"):
+		key, err := base64.StdEncoding.DecodeString(s[len("base64:"):])
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 key: %v", err)
+		}
+		return key, nil
+	case strings.HasPrefix(s, "env:"):
+		name := s[len("env:"):]
+		val, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("key environment variable %s is not set", name)
+		}
+		if strings.HasPrefix(val, "hex:") || strings.HasPrefix(val, "base64:") {
+			return ResolveKey(val)
+		}
+		return []byte(val), nil
+	case strings.HasPrefix(s, "file:"):
+		key, err := os.ReadFile(s[len("file:"):])
+		if err != nil {
+			return nil, fmt.Errorf("read key file failed: %v", err)
+		}
+		return key, nil
+	}
+	return []byte(s), nil
+}
+
+// checkClientKeys returns an error if a key param of the spec data of the
+// codec name uses the env: or file: form of ResolveKey.
+func checkClientKeys(name, data string) error {
+	meta, err := Describe(name)
+	if err != nil {
+		return err
+	}
+	var spec map[string]json.RawMessage
+	if json.Unmarshal([]byte(data), &spec) != nil {
+		return nil // reported when the spec is unmarshaled into the codec
+	}
+	for _, p := range meta.Params {
+		if p.Type != "key" {
+			continue
+		}
+		// field names are matched case-insensitively by json.Unmarshal
+		for field, raw := range spec {
+			var val string
+			if !strings.EqualFold(field, p.Name) || json.Unmarshal(raw, &val) != nil {
+				continue
+			}
+			if strings.HasPrefix(val, "env:") || strings.HasPrefix(val, "file:") {
+				return fmt.Errorf("invalid %s codec spec: %s may only use env: and file: keys in the config", name, p.Name)
+			}
+		}
+	}
+	return nil
+}
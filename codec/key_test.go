@@ -0,0 +1,39 @@
+package codec
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClientKeys(t *testing.T) {
+	t.Setenv("HPROTOXY_TEST_KEY", "0123456789abcdef")
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("0123456789abcdef"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		chain      string
+		clientOK   bool
+		trustedErr bool
+	}{
+		{`rc4:{"key":"secret"}`, true, false},
+		{`rc4:{"key":"hex:00ff"}`, true, false},
+		{`rc4:{"key":"env:HPROTOXY_TEST_KEY"}`, false, false},
+		{`rc4:{"KEY":"env:HPROTOXY_TEST_KEY"}`, false, false},
+		{`rc4:{"key":"file:` + keyFile + `"}`, false, false},
+		{`aes:{"key":"0123456789abcdef","iv":"env:HPROTOXY_TEST_KEY"}`, false, false},
+		{`aesgcm:{"key":"0123456789abcdef","aad":"file:` + keyFile + `"}`, false, false},
+		{`base64:{};rc4:{"key":"env:HPROTOXY_TEST_KEY"}`, false, false},
+		{`rc4:{"key":"env:HPROTOXY_TEST_UNSET"}`, false, true},
+	}
+	for _, tt := range tests {
+		if _, err := ParserClientCodes(tt.chain); (err == nil) != tt.clientOK {
+			t.Errorf("ParserClientCodes(%s) error = %v, want ok %v", tt.chain, err, tt.clientOK)
+		}
+		if _, err := ParserCodes(tt.chain); (err != nil) != tt.trustedErr {
+			t.Errorf("ParserCodes(%s) error = %v, want error %v", tt.chain, err, tt.trustedErr)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+const (
+	paddingPKCS7    = "pkcs7"
+	paddingZero     = "zero"
+	paddingISO10126 = "iso10126"
+	paddingNone     = "none"
+)
+
+var errBadPadding = errors.New("invalid padding")
+
+func validPadding(padding string) bool {
+	switch padding {
+	case paddingPKCS7, paddingZero, paddingISO10126, paddingNone:
+		return true
+	}
+	return false
+}
+
+// pad appends padding to data so its length is a multiple of blockSize.
+func pad(padding string, data []byte, blockSize int) ([]byte, error) {
+	n := blockSize - len(data)%blockSize
+	switch padding {
+	case paddingPKCS7:
+		return append(data, bytes.Repeat([]byte{byte(n)}, n)...), nil
+	case paddingZero:
+		if n == blockSize {
+			return data, nil
+		}
+		return append(data, make([]byte, n)...), nil
+	case paddingISO10126:
+		padText := make([]byte, n)
+		if _, err := rand.Read(padText[:n-1]); err != nil {
+			return nil, err
+		}
+		padText[n-1] = byte(n)
+		return append(data, padText...), nil
+	case paddingNone:
+		return data, nil
+	}
+	return nil, fmt.Errorf("unknown padding: %s", padding)
+}
+
+// unpad removes the padding added by pad, checking it is well formed.
+func unpad(padding string, data []byte, blockSize int) ([]byte, error) {
+	if padding == paddingNone {
+		return data, nil
+	}
+	if len(data)%blockSize != 0 {
+		return nil, fmt.Errorf("src length %d is not a multiple of the block size %d", len(data), blockSize)
+	}
+	switch padding {
+	case paddingPKCS7, paddingISO10126:
+		if len(data) == 0 {
+			return nil, errBadPadding
+		}
+		n := int(data[len(data)-1])
+		if n == 0 || n > blockSize || n > len(data) {
+			return nil, errBadPadding
+		}
+		if padding == paddingPKCS7 && !bytes.Equal(data[len(data)-n:len(data)-1], bytes.Repeat([]byte{byte(n)}, n-1)) {
+			return nil, errBadPadding
+		}
+		return data[:len(data)-n], nil
+	case paddingZero:
+		return bytes.TrimRight(data, "\x00"), nil
+	}
+	return nil, fmt.Errorf("unknown padding: %s", padding)
+}
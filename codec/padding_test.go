@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUnpad(t *testing.T) {
+	block := func(tail ...byte) []byte {
+		return append(bytes.Repeat([]byte{'a'}, 16-len(tail)), tail...)
+	}
+	tests := []struct {
+		name    string
+		padding string
+		data    []byte
+		want    []byte
+		wantErr bool
+	}{
+		{"pkcs7", paddingPKCS7, block(3, 3, 3), bytes.Repeat([]byte{'a'}, 13), false},
+		{"pkcs7 full block", paddingPKCS7, bytes.Repeat([]byte{16}, 16), []byte{}, false},
+		{"pkcs7 empty", paddingPKCS7, nil, nil, true},
+		{"pkcs7 zero length byte", paddingPKCS7, block(0), nil, true},
+		{"pkcs7 length over block", paddingPKCS7, block(17), nil, true},
+		{"pkcs7 inconsistent bytes", paddingPKCS7, block(1, 2, 3), nil, true},
+		{"pkcs7 not a multiple", paddingPKCS7, []byte{1, 1, 1}, nil, true},
+		{"iso10126", paddingISO10126, block(9, 7, 3), bytes.Repeat([]byte{'a'}, 13), false},
+		{"iso10126 empty", paddingISO10126, []byte{}, nil, true},
+		{"iso10126 length over block", paddingISO10126, block(200), nil, true},
+		{"zero", paddingZero, block(0, 0), bytes.Repeat([]byte{'a'}, 14), false},
+		{"zero empty", paddingZero, nil, nil, false},
+		{"zero not a multiple", paddingZero, []byte{0}, nil, true},
+		{"none", paddingNone, []byte{1, 2, 3}, []byte{1, 2, 3}, false},
+		{"unknown", "nope", block(), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unpad(tt.padding, tt.data, 16)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unpad() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(got, tt.want) {
+				t.Errorf("unpad() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPadRoundTrip(t *testing.T) {
+	for _, padding := range []string{paddingPKCS7, paddingISO10126, paddingZero} {
+		for n := 0; n <= 33; n++ {
+			data := bytes.Repeat([]byte{'x'}, n)
+			padded, err := pad(padding, append([]byte{}, data...), 16)
+			if err != nil {
+				t.Fatalf("%s: pad(%d bytes): %v", padding, n, err)
+			}
+			if len(padded)%16 != 0 {
+				t.Fatalf("%s: pad(%d bytes) = %d bytes", padding, n, len(padded))
+			}
+			got, err := unpad(padding, padded, 16)
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%s: unpad(pad(%d bytes)) = %v, %v", padding, n, got, err)
+			}
+		}
+	}
+}
+
+func TestAESDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		spec string
+		data []byte
+	}{
+		{`{"key":"0123456789abcdef","iv":"0123456789abcdef"}`, nil},
+		{`{"key":"0123456789abcdef","iv":"0123456789abcdef"}`, []byte("short")},
+		{`{"key":"0123456789abcdef","iv":"0123456789abcdef"}`, bytes.Repeat([]byte{'a'}, 16)},
+		{`{"key":"0123456789abcdef","mode":"ecb"}`, bytes.Repeat([]byte{'a'}, 17)},
+	}
+	for _, tt := range tests {
+		c, err := GenCodec("aes", tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Decode(tt.data); err == nil {
+			t.Errorf("aes %s: Decode(%q) succeeded", tt.spec, tt.data)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package codec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	wireVarint  = "varint"
+	wireFixed32 = "fixed32"
+	wireFixed64 = "fixed64"
+	wireBytes   = "bytes"
+	wireGroup   = "group"
+
+	defaultRawDepth = 16
+)
+
+func init() {
+	Register("pbraw", func() Codec { return new(rawProtoCodec) }, Meta{
+		Description: "schemaless protobuf wire format <-> json tree of fields, like protoc --decode_raw",
+		Params: []Param{
+			{Name: "maxDepth", Type: "number", Desc: "max nesting of guessed sub messages, default 16"},
+		},
+		Symmetric: true,
+	})
+}
+
+// rawField is one field of a message in wire format. Value holds varint and
+// fixed values; a length-delimited field holds exactly one of Message,
+// String, Packed or Bytes, which is the best guess of its content. The
+// other fields are informational only and ignored when encoding.
+type rawField struct {
+	Field protowire.Number `json:"field"`
+	Wire  string           `json:"wire"`
+
+	Value  *json.Number `json:"value,omitempty"`
+	Sint   *int64       `json:"sint,omitempty"`
+	Int    *int64       `json:"int,omitempty"`
+	Float  *float64     `json:"float,omitempty"`
+	Double *float64     `json:"double,omitempty"`
+
+	Message []*rawField `json:"message,omitempty"`
+	Group   []*rawField `json:"group,omitempty"`
+	String  *string     `json:"string,omitempty"`
+	Packed  []uint64    `json:"packed,omitempty"`
+	Bytes   *string     `json:"bytes,omitempty"`
+}
+
+type rawProtoCodec struct {
+	MaxDepth int `json:"maxDepth"`
+}
+
+func (c *rawProtoCodec) Name() string {
+	return "pbraw"
+}
+
+func (c *rawProtoCodec) Init() error {
+	if c.MaxDepth <= 0 {
+		c.MaxDepth = defaultRawDepth
+	}
+	return nil
+}
+
+func (c *rawProtoCodec) Decode(data []byte) ([]byte, error) {
+	fields, err := parseRawFields(data, c.MaxDepth, 0)
+	if err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		fields = []*rawField{}
+	}
+	return json.Marshal(fields)
+}
+
+func (c *rawProtoCodec) Encode(data []byte) ([]byte, error) {
+	var fields []*rawField
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return appendRawFields(nil, fields)
+}
+
+// parseRawFields parses data as a sequence of fields. An end group tag for
+// group ends the sequence; a group of 0 means none is expected.
+func parseRawFields(data []byte, maxDepth int, group protowire.Number) ([]*rawField, error) {
+	fields, n, err := consumeRawFields(data, maxDepth, group)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(data) {
+		return nil, errors.New("unexpected end group")
+	}
+	return fields, nil
+}
+
+func consumeRawFields(data []byte, maxDepth int, group protowire.Number) ([]*rawField, int, error) {
+	var fields []*rawField
+	pos := 0
+	for pos < len(data) {
+		num, typ, n := protowire.ConsumeTag(data[pos:])
+		if n < 0 {
+			return nil, 0, protowire.ParseError(n)
+		}
+		pos += n
+		f := &rawField{Field: num}
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data[pos:])
+			if n < 0 {
+				return nil, 0, protowire.ParseError(n)
+			}
+			pos += n
+			f.Wire = wireVarint
+			f.Value = uintNumber(v)
+			sint := protowire.DecodeZigZag(v)
+			f.Sint = &sint
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(data[pos:])
+			if n < 0 {
+				return nil, 0, protowire.ParseError(n)
+			}
+			pos += n
+			f.Wire = wireFixed32
+			f.Value = uintNumber(uint64(v))
+			i, fl := int64(int32(v)), float64(math.Float32frombits(v))
+			f.Int = &i
+			if !math.IsNaN(fl) && !math.IsInf(fl, 0) {
+				f.Float = &fl
+			}
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(data[pos:])
+			if n < 0 {
+				return nil, 0, protowire.ParseError(n)
+			}
+			pos += n
+			f.Wire = wireFixed64
+			f.Value = uintNumber(v)
+			i, fl := int64(v), math.Float64frombits(v)
+			f.Int = &i
+			if !math.IsNaN(fl) && !math.IsInf(fl, 0) {
+				f.Double = &fl
+			}
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data[pos:])
+			if n < 0 {
+				return nil, 0, protowire.ParseError(n)
+			}
+			pos += n
+			f.Wire = wireBytes
+			guessBytes(f, v, maxDepth)
+		case protowire.StartGroupType:
+			if maxDepth <= 0 {
+				return nil, 0, errors.New("groups nested too deep")
+			}
+			sub, n, err := consumeRawFields(data[pos:], maxDepth-1, num)
+			if err != nil {
+				return nil, 0, err
+			}
+			pos += n
+			f.Wire = wireGroup
+			f.Group = sub
+			if f.Group == nil {
+				f.Group = []*rawField{}
+			}
+		case protowire.EndGroupType:
+			if num != group {
+				return nil, 0, fmt.Errorf("unexpected end group %d", num)
+			}
+			return fields, pos, nil
+		default:
+			return nil, 0, fmt.Errorf("invalid wire type %d", typ)
+		}
+		fields = append(fields, f)
+	}
+	if group != 0 {
+		return nil, 0, fmt.Errorf("missing end group %d", group)
+	}
+	return fields, pos, nil
+}
+
+// guessBytes picks the most likely interpretation of a length-delimited
+// value: printable text, a nested message, packed varints or plain bytes.
+func guessBytes(f *rawField, v []byte, maxDepth int) {
+	if printable(v) {
+		s := string(v)
+		f.String = &s
+		return
+	}
+	if maxDepth > 0 {
+		if sub, err := parseRawFields(v, maxDepth-1, 0); err == nil {
+			f.Message = sub
+			return
+		}
+	}
+	if packed, ok := parsePacked(v); ok {
+		f.Packed = packed
+		return
+	}
+	b := base64.StdEncoding.EncodeToString(v)
+	f.Bytes = &b
+}
+
+func printable(v []byte) bool {
+	if !utf8.Valid(v) {
+		return false
+	}
+	for _, r := range string(v) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func parsePacked(v []byte) ([]uint64, bool) {
+	var res []uint64
+	for len(v) > 0 {
+		x, n := protowire.ConsumeVarint(v)
+		if n < 0 {
+			return nil, false
+		}
+		res = append(res, x)
+		v = v[n:]
+	}
+	return res, len(res) > 0
+}
+
+func uintNumber(v uint64) *json.Number {
+	n := json.Number(strconv.FormatUint(v, 10))
+	return &n
+}
+
+// parseNumber reads a json number as uint64, accepting negative values in
+// two's complement.
+func parseNumber(n *json.Number) (uint64, error) {
+	if n == nil {
+		return 0, errors.New("missing value")
+	}
+	if v, err := strconv.ParseUint(n.String(), 10, 64); err == nil {
+		return v, nil
+	}
+	v, err := strconv.ParseInt(n.String(), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %s", n.String())
+	}
+	return uint64(v), nil
+}
+
+func appendRawFields(b []byte, fields []*rawField) ([]byte, error) {
+	for _, f := range fields {
+		var err error
+		if b, err = appendRawField(b, f); err != nil {
+			return nil, fmt.Errorf("field %d: %v", f.Field, err)
+		}
+	}
+	return b, nil
+}
+
+func appendRawField(b []byte, f *rawField) ([]byte, error) {
+	if !f.Field.IsValid() {
+		return nil, errors.New("invalid field number")
+	}
+	switch f.Wire {
+	case wireVarint:
+		v, err := parseNumber(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, f.Field, protowire.VarintType)
+		return protowire.AppendVarint(b, v), nil
+	case wireFixed32:
+		v, err := parseNumber(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, f.Field, protowire.Fixed32Type)
+		return protowire.AppendFixed32(b, uint32(v)), nil
+	case wireFixed64:
+		v, err := parseNumber(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, f.Field, protowire.Fixed64Type)
+		return protowire.AppendFixed64(b, v), nil
+	case wireBytes:
+		var v []byte
+		var err error
+		switch {
+		case f.Message != nil:
+			v, err = appendRawFields(nil, f.Message)
+		case f.String != nil:
+			v = []byte(*f.String)
+		case f.Packed != nil:
+			for _, x := range f.Packed {
+				v = protowire.AppendVarint(v, x)
+			}
+		case f.Bytes != nil:
+			v, err = base64.StdEncoding.DecodeString(*f.Bytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+		b = protowire.AppendTag(b, f.Field, protowire.BytesType)
+		return protowire.AppendBytes(b, v), nil
+	case wireGroup:
+		b = protowire.AppendTag(b, f.Field, protowire.StartGroupType)
+		b, err := appendRawFields(b, f.Group)
+		if err != nil {
+			return nil, err
+		}
+		return protowire.AppendTag(b, f.Field, protowire.EndGroupType), nil
+	}
+	return nil, fmt.Errorf("unknown wire type %q", f.Wire)
+}
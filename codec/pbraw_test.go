@@ -0,0 +1,100 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestRawProtoRoundTrip(t *testing.T) {
+	nested := protowire.AppendTag(nil, 1, protowire.BytesType)
+	nested = protowire.AppendString(nested, "inner")
+	nested = protowire.AppendTag(nested, 2, protowire.VarintType)
+	nested = protowire.AppendVarint(nested, 7)
+
+	var packed []byte
+	for _, v := range []uint64{1, 300, 70000} {
+		packed = protowire.AppendVarint(packed, v)
+	}
+
+	group := protowire.AppendTag(nil, 9, protowire.StartGroupType)
+	group = protowire.AppendTag(group, 1, protowire.VarintType)
+	group = protowire.AppendVarint(group, 3)
+	group = protowire.AppendTag(group, 9, protowire.EndGroupType)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string // expected in the decoded tree
+	}{
+		{"empty", nil, `[]`},
+		{"varint", append(protowire.AppendTag(nil, 1, protowire.VarintType), protowire.AppendVarint(nil, 150)...), `"value":150`},
+		{"negative varint", append(protowire.AppendTag(nil, 1, protowire.VarintType), protowire.AppendVarint(nil, protowire.EncodeZigZag(-5))...), `"sint":-5`},
+		{"fixed32", append(protowire.AppendTag(nil, 2, protowire.Fixed32Type), protowire.AppendFixed32(nil, 0x3f800000)...), `"float":1`},
+		{"fixed64", append(protowire.AppendTag(nil, 3, protowire.Fixed64Type), protowire.AppendFixed64(nil, 0x3ff0000000000000)...), `"double":1`},
+		{"string", protowire.AppendString(protowire.AppendTag(nil, 4, protowire.BytesType), "hello"), `"string":"hello"`},
+		{"message", protowire.AppendBytes(protowire.AppendTag(nil, 5, protowire.BytesType), nested), `"message":[`},
+		{"packed", protowire.AppendBytes(protowire.AppendTag(nil, 6, protowire.BytesType), packed), `"packed":[1,300,70000]`},
+		{"bytes", protowire.AppendBytes(protowire.AppendTag(nil, 7, protowire.BytesType), []byte{0xff, 0x00, 0xfe}), `"bytes":"/wD+"`},
+		{"group", group, `"group":[`},
+	}
+	c, err := GenCodec("pbraw", "{}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := c.Decode(tt.data)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !bytes.Contains(tree, []byte(tt.want)) {
+				t.Errorf("Decode = %s, want it to contain %s", tree, tt.want)
+			}
+			if !json.Valid(tree) {
+				t.Fatalf("Decode = %s, not json", tree)
+			}
+			data, err := c.Encode(tree)
+			if err != nil {
+				t.Fatalf("Encode(%s): %v", tree, err)
+			}
+			if !bytes.Equal(data, tt.data) {
+				t.Errorf("Encode(Decode(%x)) = %x", tt.data, data)
+			}
+		})
+	}
+}
+
+func TestRawProtoErrors(t *testing.T) {
+	decode := []struct {
+		name string
+		data []byte
+	}{
+		{"truncated varint", []byte{0x08, 0x80}},
+		{"truncated length", []byte{0x0a, 0x05, 'a'}},
+		{"truncated fixed32", []byte{0x15, 0x01}},
+		{"field number 0", []byte{0x00, 0x01}},
+		{"unmatched end group", []byte{0x0c}},
+		{"unterminated group", []byte{0x0b, 0x08, 0x01}},
+	}
+	c, _ := GenCodec("pbraw", "{}")
+	for _, tt := range decode {
+		if out, err := c.Decode(tt.data); err == nil {
+			t.Errorf("%s: Decode(%x) = %s, want error", tt.name, tt.data, out)
+		}
+	}
+
+	encode := []string{
+		`not json`,
+		`[{"field":1,"wire":"nope"}]`,
+		`[{"field":1,"wire":"varint"}]`,
+		`[{"field":1,"wire":"bytes","bytes":"!!"}]`,
+	}
+	for _, tree := range encode {
+		if out, err := c.Encode([]byte(tree)); err == nil {
+			t.Errorf("Encode(%s) = %x, want error", tree, out)
+		}
+	}
+}
@@ -5,21 +5,66 @@ import (
 	"fmt"
 
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/dynamic"
 	"github.com/zzong12/hprotoxy/loader"
 )
 
+func init() {
+	Register("pb", func() Codec { return new(protoCodec) }, Meta{
+		Description: "json <-> protobuf using loaded message descriptors",
+		Params: []Param{
+			{Name: "req", Type: "string", Desc: "message name used to encode"},
+			{Name: "res", Type: "string", Desc: "message name used to decode, * to infer it from the data"},
+			{Name: "method", Type: "string", Desc: "rpc method as pkg.Service/Method, its input and output types are used when req/res are empty"},
+			{Name: "candidates", Type: "array", Desc: "message names tried when res is *, a.b.* matches a package, default the types of the loaded files without well-known types and dependencies"},
+			{Name: "ns", Type: "string", Desc: "schema namespace the messages are looked up in, default is the default namespace"},
+		},
+		// Encode uses req and Decode res, so the same spec only round-trips
+		// when both name the same message.
+		Symmetric: false,
+	})
+}
+
 type protoCodec struct {
-	Req string `json:"req"`
-	Res string `json:"res"`
+	Req        string   `json:"req"`
+	Res        string   `json:"res"`
+	Method     string   `json:"method"`
+	Candidates []string `json:"candidates"`
+	NS         string   `json:"ns"`
 }
 
 func (c *protoCodec) Name() string {
 	return "pb"
 }
 
+// registry returns the registry of the namespace of c.
+func (c *protoCodec) registry() (*loader.Registry, error) {
+	return loader.GetLocalLoader().Snapshot().Select(c.NS)
+}
+
+// messageDescriptor returns the descriptor of name, falling back to the
+// input or output type of the method when name is empty.
+func (c *protoCodec) messageDescriptor(name string, input bool) (*desc.MessageDescriptor, error) {
+	registry, err := c.registry()
+	if err != nil {
+		return nil, err
+	}
+	if name != "" || c.Method == "" {
+		return registry.GetMessageDescriptor(name)
+	}
+	md, err := registry.GetMethodDescriptor(c.Method)
+	if err != nil {
+		return nil, err
+	}
+	if input {
+		return md.GetInputType(), nil
+	}
+	return md.GetOutputType(), nil
+}
+
 func (c *protoCodec) Encode(data []byte) ([]byte, error) {
-	desc, err := loader.GetLocalLoader().GetMessageDescriptor(c.Req)
+	desc, err := c.messageDescriptor(c.Req, true)
 	if err != nil {
 		return nil, err
 	}
@@ -32,7 +77,10 @@ func (c *protoCodec) Encode(data []byte) ([]byte, error) {
 }
 
 func (c *protoCodec) Decode(data []byte) ([]byte, error) {
-	desc, err := loader.GetLocalLoader().GetMessageDescriptor(c.Res)
+	if c.Res == inferType {
+		return c.decodeInfer(data)
+	}
+	desc, err := c.messageDescriptor(c.Res, false)
 	if err != nil {
 		return nil, err
 	}
@@ -40,12 +88,16 @@ func (c *protoCodec) Decode(data []byte) ([]byte, error) {
 	if err = msg.Unmarshal(data); err != nil {
 		return nil, err
 	}
+	return marshalMessage(msg)
+}
+
+func marshalMessage(msg *dynamic.Message) ([]byte, error) {
 	marshaler := jsonpb.Marshaler{
 		EmitDefaults: true,
 	}
 	buf := bytes.NewBuffer(nil)
 
-	if err = marshaler.Marshal(buf, msg); err != nil {
+	if err := marshaler.Marshal(buf, msg); err != nil {
 		return nil, fmt.Errorf("Failed to marshal response: %v", err)
 	}
 	return buf.Bytes(), nil
@@ -1,26 +1,51 @@
 package codec
 
-import "crypto/rc4"
+import (
+	"crypto/cipher"
+	"crypto/rc4"
+	"io"
+)
+
+func init() {
+	Register("rc4", func() Codec { return new(rc4Codec) }, Meta{
+		Description: "RC4 stream cipher",
+		Params: []Param{
+			{Name: "key", Type: "key", Required: true, Desc: "cipher key"},
+		},
+		Symmetric: true,
+	})
+}
 
 type rc4Codec struct {
 	Key string `json:"key"`
 	Iv  string `json:"iv"`
+
+	key []byte
 }
 
 func (c *rc4Codec) Name() string {
 	return "rc4"
 }
 
+func (c *rc4Codec) Init() error {
+	var err error
+	if c.key, err = ResolveKey(c.Key); err != nil {
+		return err
+	}
+	_, err = rc4.NewCipher(c.key)
+	return err
+}
+
 func (c *rc4Codec) Encode(data []byte) ([]byte, error) {
-	return c.encrip(c.Key, data)
+	return c.encrip(c.key, data)
 }
 
 func (c *rc4Codec) Decode(data []byte) ([]byte, error) {
-	return c.encrip(c.Key, data)
+	return c.encrip(c.key, data)
 }
 
-func (c *rc4Codec) encrip(key string, src []byte) ([]byte, error) {
-	cipher, err := rc4.NewCipher([]byte(key))
+func (c *rc4Codec) encrip(key []byte, src []byte) ([]byte, error) {
+	cipher, err := rc4.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
@@ -28,3 +53,19 @@ func (c *rc4Codec) encrip(key string, src []byte) ([]byte, error) {
 	cipher.XORKeyStream(encrypt, src)
 	return encrypt, nil
 }
+
+func (c *rc4Codec) EncodeStream(r io.Reader) (io.Reader, error) {
+	return c.stream(r)
+}
+
+func (c *rc4Codec) DecodeStream(r io.Reader) (io.Reader, error) {
+	return c.stream(r)
+}
+
+func (c *rc4Codec) stream(r io.Reader) (io.Reader, error) {
+	s, err := rc4.NewCipher(c.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.StreamReader{S: s, R: r}, nil
+}
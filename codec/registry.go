@@ -0,0 +1,95 @@
+package codec
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory returns a new zero-valued codec, ready to have its JSON spec
+// unmarshaled into it.
+type Factory func() Codec
+
+// Param describes one field of a codec's JSON spec.
+type Param struct {
+	Name string `json:"name"`
+	// Type is one of "string", "number", "bool", "object", "array" or
+	// "key", the latter accepting the forms understood by ResolveKey.
+	Type     string `json:"type"`
+	Required bool   `json:"required"`
+	Desc     string `json:"desc"`
+}
+
+// Meta describes a registered codec for listings in the manager and CLI.
+type Meta struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Params      []Param `json:"params"`
+	// Symmetric reports whether Decode undoes Encode with the same spec, so
+	// the codec can be used in a request chain that is inverted for the
+	// response.
+	Symmetric bool `json:"symmetric"`
+}
+
+type registration struct {
+	factory Factory
+	meta    Meta
+}
+
+var (
+	registryLock sync.RWMutex
+	registry     = make(map[string]*registration)
+)
+
+// Register makes a codec available under name to ParserCodes and GenCodec.
+// It is meant to be called from init functions and panics if name is empty,
+// factory is nil or name is already registered.
+func Register(name string, factory Factory, meta Meta) {
+	if name == "" {
+		panic("codec: Register with empty name")
+	}
+	if factory == nil {
+		panic("codec: Register factory is nil for " + name)
+	}
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	if _, dup := registry[name]; dup {
+		panic("codec: Register called twice for " + name)
+	}
+	meta.Name = name
+	registry[name] = &registration{factory: factory, meta: meta}
+}
+
+// Lookup returns the factory registered under name.
+func Lookup(name string) (Factory, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	reg, ok := registry[name]
+	if !ok {
+		return nil, false
+	}
+	return reg.factory, true
+}
+
+// Describe returns the metadata of the codec registered under name.
+func Describe(name string) (Meta, error) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	reg, ok := registry[name]
+	if !ok {
+		return Meta{}, fmt.Errorf("not found codec: %s", name)
+	}
+	return reg.meta, nil
+}
+
+// List returns the metadata of all registered codecs sorted by name.
+func List() []Meta {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+	res := make([]Meta, 0, len(registry))
+	for _, reg := range registry {
+		res = append(res, reg.meta)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
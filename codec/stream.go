@@ -0,0 +1,233 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// streamChunkSize is the size of the reads of stream encoders.
+const streamChunkSize = 32 << 10
+
+// ErrNotStreamable is returned by StreamCodec methods and the stream
+// methods of Codecs when data can't be processed as a stream.
+var ErrNotStreamable = errors.New("codec can not stream")
+
+// StreamCodec is implemented by codecs that can process data as it is
+// read, without buffering it whole. EncodeStream and DecodeStream must not
+// read from r before the returned reader is read from, so a caller getting
+// ErrNotStreamable can fall back to Encode/Decode. Errors in the data are
+// returned by the Read of the returned reader.
+type StreamCodec interface {
+	Codec
+	EncodeStream(r io.Reader) (io.Reader, error)
+	DecodeStream(r io.Reader) (io.Reader, error)
+}
+
+// elementReader is implemented by Splitters that can read their elements
+// from a stream one at a time.
+type elementReader interface {
+	Splitter
+	// readElement returns the next element of r, io.EOF at the end of r.
+	readElement(r *bufio.Reader) ([]byte, error)
+}
+
+// EncodeStream is like EncodeAll but returns a reader of the encoded data.
+// It returns ErrNotStreamable, without reading r, if a codec of the chain
+// can't stream; codecs applied per element of a Splitter are run on the
+// buffered element, so they don't need to.
+func (cs Codecs) EncodeStream(r io.Reader) (io.Reader, error) {
+	if k := cs.splitter(true); k >= 0 {
+		er, ok := cs[k].(elementReader)
+		if !ok {
+			return nil, ErrNotStreamable
+		}
+		return cs[k+1:].EncodeStream(encodeElements(r, cs[:k], er))
+	}
+	for _, c := range cs {
+		sc, ok := c.(StreamCodec)
+		if !ok {
+			return nil, ErrNotStreamable
+		}
+		var err error
+		if r, err = sc.EncodeStream(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// DecodeStream is like DecodeAll but returns a reader of the decoded data,
+// or ErrNotStreamable without reading r.
+func (cs Codecs) DecodeStream(r io.Reader) (io.Reader, error) {
+	for i, c := range cs {
+		if _, ok := c.(Splitter); ok {
+			er, ok := c.(elementReader)
+			if !ok {
+				return nil, ErrNotStreamable
+			}
+			return decodeElements(r, er, cs[i+1:]), nil
+		}
+		sc, ok := c.(StreamCodec)
+		if !ok {
+			return nil, ErrNotStreamable
+		}
+		var err error
+		if r, err = sc.DecodeStream(r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// decodeElements returns a reader of the elements of r, decoded by cs, as a
+// JSON array.
+func decodeElements(r io.Reader, er elementReader, cs Codecs) io.Reader {
+	br := bufio.NewReader(r)
+	i := 0
+	return &chunkReader{next: func(buf *bytes.Buffer) error {
+		if i == 0 {
+			buf.WriteByte('[')
+		}
+		e, err := er.readElement(br)
+		if err == io.EOF {
+			buf.WriteByte(']')
+			return io.EOF
+		}
+		if err == nil {
+			e, err = cs.DecodeAll(e)
+		}
+		if err != nil {
+			return fmt.Errorf("element %d: %v", i, err)
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(jsonElement(e))
+		i++
+		return nil
+	}}
+}
+
+// encodeElements returns a reader of the elements of the JSON array in r,
+// encoded by cs and joined by er.
+func encodeElements(r io.Reader, cs Codecs, er elementReader) io.Reader {
+	dec := json.NewDecoder(r)
+	i := -1
+	return &chunkReader{next: func(buf *bytes.Buffer) error {
+		if i < 0 {
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+				return errors.New("want a json array of messages")
+			}
+			i = 0
+		}
+		if !dec.More() {
+			if _, err := dec.Token(); err != nil {
+				return fmt.Errorf("want a json array of messages: %v", err)
+			}
+			return io.EOF
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return fmt.Errorf("element %d: %v", i, err)
+		}
+		e, err := elementFromJSON(raw)
+		if err == nil {
+			e, err = cs.EncodeAll(e)
+		}
+		if err == nil {
+			e, err = er.Join([][]byte{e})
+		}
+		if err != nil {
+			return fmt.Errorf("element %d: %v", i, err)
+		}
+		buf.Write(e)
+		i++
+		return nil
+	}}
+}
+
+// chunkReader returns the output of next piece by piece. next appends the
+// next piece to buf and returns io.EOF after the last one; its errors are
+// returned by Read once buf is drained.
+type chunkReader struct {
+	next func(buf *bytes.Buffer) error
+	buf  bytes.Buffer
+	err  error
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for c.buf.Len() == 0 && c.err == nil {
+		c.err = c.next(&c.buf)
+	}
+	if c.buf.Len() > 0 {
+		return c.buf.Read(p)
+	}
+	return 0, c.err
+}
+
+// lazyReader calls open on the first Read, for readers like gzip.Reader
+// that read from their source when created.
+type lazyReader struct {
+	open func() (io.Reader, error)
+	r    io.Reader
+	err  error
+}
+
+func (l *lazyReader) Read(p []byte) (int, error) {
+	if l.r == nil && l.err == nil {
+		l.r, l.err = l.open()
+	}
+	if l.err != nil {
+		return 0, l.err
+	}
+	return l.r.Read(p)
+}
+
+// flusher is implemented by writers like gzip.Writer that buffer output.
+type flusher interface {
+	Flush() error
+}
+
+// encodeChunks returns a reader of r written through the writer newW
+// returns. The writer is flushed after every read from r, so the output
+// keeps up with a slow source.
+func encodeChunks(r io.Reader, newW func(io.Writer) io.WriteCloser) io.Reader {
+	var enc io.WriteCloser
+	var src []byte
+	c := &chunkReader{}
+	c.next = func(buf *bytes.Buffer) error {
+		if enc == nil {
+			enc, src = newW(buf), make([]byte, streamChunkSize)
+		}
+		n, err := r.Read(src)
+		if n > 0 {
+			if _, err := enc.Write(src[:n]); err != nil {
+				return err
+			}
+			if f, ok := enc.(flusher); ok {
+				if err := f.Flush(); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			if err := enc.Close(); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+	return c
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF, for data that ends early.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
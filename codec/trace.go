@@ -0,0 +1,66 @@
+package codec
+
+import "strings"
+
+// Stage is the result of one codec in a traced run of a chain.
+type Stage struct {
+	Codec  string
+	Output []byte
+	Err    error
+}
+
+// EncodeTrace is like EncodeAll but records the output of every codec. On
+// failure the last stage holds the error, later codecs are not run. Codecs
+// applied per element of a Splitter, or to the message of an Enveloper,
+// are recorded as one stage together with it.
+func (cs Codecs) EncodeTrace(data []byte) ([]Stage, error) {
+	k := cs.boundary(true)
+	if k < 0 {
+		return cs.trace(data, Codec.Encode)
+	}
+	data, err := cs[:k+1].EncodeAll(data)
+	stages := []Stage{{Codec: cs[:k+1].names(), Output: data, Err: err}}
+	if err != nil {
+		return stages, err
+	}
+	rest, err := cs[k+1:].trace(data, Codec.Encode)
+	return append(stages, rest...), err
+}
+
+// DecodeTrace is like DecodeAll but records the output of every codec.
+func (cs Codecs) DecodeTrace(data []byte) ([]Stage, error) {
+	i := cs.boundary(false)
+	if i < 0 {
+		return cs.trace(data, Codec.Decode)
+	}
+	stages, err := cs[:i].trace(data, Codec.Decode)
+	if err != nil {
+		return stages, err
+	}
+	if len(stages) > 0 {
+		data = stages[len(stages)-1].Output
+	}
+	data, err = cs[i:].DecodeAll(data)
+	return append(stages, Stage{Codec: cs[i:].names(), Output: data, Err: err}), err
+}
+
+func (cs Codecs) names() string {
+	names := make([]string, len(cs))
+	for i, c := range cs {
+		names[i] = c.Name()
+	}
+	return strings.Join(names, "+")
+}
+
+func (cs Codecs) trace(data []byte, fn func(Codec, []byte) ([]byte, error)) ([]Stage, error) {
+	stages := make([]Stage, 0, len(cs))
+	for _, c := range cs {
+		var err error
+		data, err = fn(c, data)
+		stages = append(stages, Stage{Codec: c.Name(), Output: data, Err: err})
+		if err != nil {
+			return stages, err
+		}
+	}
+	return stages, nil
+}
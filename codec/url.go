@@ -2,6 +2,13 @@ package codec
 
 import "net/url"
 
+func init() {
+	Register("url", func() Codec { return new(urlCodec) }, Meta{
+		Description: "url query escaping",
+		Symmetric:   true,
+	})
+}
+
 type urlCodec struct {
 }
 
@@ -19,4 +26,4 @@ func (c *urlCodec) Decode(data []byte) ([]byte, error) {
 		return nil, err
 	}
 	return []byte(res), nil
-}
\ No newline at end of file
+}
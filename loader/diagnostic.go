@@ -0,0 +1,126 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is an error or warning found while loading schemas.
+type Diagnostic struct {
+	Namespace string `json:"namespace,omitempty"`
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	Message   string `json:"message"`
+	Severity  string `json:"severity"`
+}
+
+func (d Diagnostic) String() string {
+	var sb strings.Builder
+	if d.File != "" {
+		sb.WriteString(qualifiedName(d.Namespace, d.File))
+		if d.Line > 0 {
+			fmt.Fprintf(&sb, ":%d:%d", d.Line, d.Column)
+		}
+		sb.WriteString(": ")
+	}
+	sb.WriteString(d.Message)
+	return sb.String()
+}
+
+// DiagnosticsError is returned when schemas don't compile. It holds all
+// errors and warnings found, not only the first one.
+type DiagnosticsError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *DiagnosticsError) Error() string {
+	var msgs []string
+	for _, d := range e.Diagnostics {
+		if d.Severity == SeverityError {
+			msgs = append(msgs, d.String())
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// diagnostics collects the diagnostics of one load.
+type diagnostics struct {
+	list []Diagnostic
+}
+
+func (d *diagnostics) add(ns, file, severity string, err error) {
+	diag := Diagnostic{Namespace: ns, File: file, Message: err.Error(), Severity: severity}
+	var posErr protoparse.ErrorWithPos
+	if errors.As(err, &posErr) {
+		pos := posErr.GetPosition()
+		diag.File, diag.Line, diag.Column = pos.Filename, pos.Line, pos.Col
+		diag.Message = posErr.Unwrap().Error()
+	}
+	d.list = append(d.list, diag)
+}
+
+func (d *diagnostics) hasErrors() bool {
+	for _, diag := range d.list {
+		if diag.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// err returns the diagnostics as an error if any of them is an error.
+func (d *diagnostics) err() error {
+	if !d.hasErrors() {
+		return nil
+	}
+	return &DiagnosticsError{Diagnostics: d.list}
+}
+
+// reporters returns parser reporters adding to d. Errors don't stop the
+// parser, so that all of them are found.
+func (d *diagnostics) reporters(ns string) (protoparse.ErrorReporter, protoparse.WarningReporter) {
+	return func(err protoparse.ErrorWithPos) error {
+			d.add(ns, "", SeverityError, err)
+			return nil
+		}, func(err protoparse.ErrorWithPos) {
+			d.add(ns, "", SeverityWarning, err)
+		}
+}
+
+// overlay holds file contents that replace the files on disk, keyed by
+// absolute path. It is used to check uploads before they are written.
+type overlay map[string][]byte
+
+func (o overlay) key(filePath string) string {
+	if abs, err := filepath.Abs(filePath); err == nil {
+		return abs
+	}
+	return filepath.Clean(filePath)
+}
+
+func (o overlay) open(filePath string) (io.ReadCloser, error) {
+	if data, ok := o[o.key(filePath)]; ok {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return os.Open(filePath)
+}
+
+func (o overlay) readFile(filePath string) ([]byte, error) {
+	if data, ok := o[o.key(filePath)]; ok {
+		return data, nil
+	}
+	return os.ReadFile(filePath)
+}
@@ -0,0 +1,60 @@
+package loader
+
+import (
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// FileMessages returns all message types of fd, nested ones included, in
+// declaration order.
+func FileMessages(fd *desc.FileDescriptor) []*desc.MessageDescriptor {
+	var res []*desc.MessageDescriptor
+	var walk func(mds []*desc.MessageDescriptor)
+	walk = func(mds []*desc.MessageDescriptor) {
+		for _, md := range mds {
+			if md.IsMapEntry() {
+				continue
+			}
+			res = append(res, md)
+			walk(md.GetNestedMessageTypes())
+		}
+	}
+	walk(fd.GetMessageTypes())
+	return res
+}
+
+// FileEnums returns all enum types of fd, nested ones included.
+func FileEnums(fd *desc.FileDescriptor) []*desc.EnumDescriptor {
+	res := append([]*desc.EnumDescriptor{}, fd.GetEnumTypes()...)
+	for _, md := range FileMessages(fd) {
+		res = append(res, md.GetNestedEnumTypes()...)
+	}
+	return res
+}
+
+// methodName normalizes a method name given as "pkg.Service/Method",
+// "/pkg.Service/Method" or "pkg.Service.Method" to its fully qualified
+// name.
+func methodName(name string) string {
+	return strings.Replace(strings.TrimPrefix(name, "/"), "/", ".", 1)
+}
+
+// withDependencies appends the files imported by files, directly or not,
+// that are missing from it, such as the well-known types.
+func withDependencies(files []*desc.FileDescriptor) []*desc.FileDescriptor {
+	seen := make(map[string]bool, len(files))
+	for _, fd := range files {
+		seen[fd.GetName()] = true
+	}
+	res := files
+	for i := 0; i < len(res); i++ {
+		for _, dep := range res[i].GetDependencies() {
+			if !seen[dep.GetName()] {
+				seen[dep.GetName()] = true
+				res = append(res, dep)
+			}
+		}
+	}
+	return res
+}
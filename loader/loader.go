@@ -1,13 +1,15 @@
 package loader
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"mime/multipart"
 	"os"
 	"path"
-	"strings"
+	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jhump/protoreflect/desc"
@@ -15,22 +17,37 @@ import (
 	"github.com/zzong12/hprotoxy/log"
 )
 
+const (
+	TriggerStart    = "start"
+	TriggerManual   = "manual"
+	TriggerInterval = "interval"
+	TriggerWatch    = "watch"
+	TriggerUpload   = "upload"
+	TriggerDelete   = "delete"
+)
+
+// ReloadReport describes the latest load attempt and what triggered it.
+type ReloadReport struct {
+	Time    time.Time `json:"time"`
+	Trigger string    `json:"trigger"`
+	// Files are the changed files that triggered the load, if known.
+	Files []string `json:"files,omitempty"`
+	Error string   `json:"error,omitempty"`
+	// Diagnostics are the errors and warnings found, if any.
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	Generation  uint64       `json:"generation"`
+}
+
 var localLoader *ProtoDescriptorLoader
 
 // must be called after Load()
-func InitLoader(importPath, loadFolder string, reloadInterval uint16) {
+func InitLoader(opts Options) {
 	localLoader = &ProtoDescriptorLoader{
-		importPath: importPath,
-		loadFolder: loadFolder,
-		parser: &protoparse.Parser{
-			ImportPaths: []string{importPath},
-		},
-		lock:           &sync.RWMutex{},
-		fileDesc:       make([]*desc.FileDescriptor, 0),
-		enumDescMap:    make(map[string]*desc.EnumDescriptor),
-		messageDescMap: make(map[string]*desc.MessageDescriptor),
-		reloadInterval: reloadInterval,
+		opts:       opts,
+		loadLock:   &sync.Mutex{},
+		reportLock: &sync.RWMutex{},
 	}
+	localLoader.registry.Store(newRegistry(0, DefaultNamespace, nil, nil))
 }
 
 func GetLocalLoader() *ProtoDescriptorLoader {
@@ -41,134 +58,385 @@ func GetLocalLoader() *ProtoDescriptorLoader {
 }
 
 type ProtoDescriptorLoader struct {
-	importPath     string
-	loadFolder     string
-	lock           *sync.RWMutex
-	lastLoadTIme   time.Time
-	reloadInterval uint16
-	parser         *protoparse.Parser
-	fileDesc       []*desc.FileDescriptor
-	enumDescMap    map[string]*desc.EnumDescriptor
-	messageDescMap map[string]*desc.MessageDescriptor
+	opts        Options
+	loadLock    *sync.Mutex
+	registry    atomic.Pointer[Registry]
+	reflection  []ReflectionSource
+	reflected   map[reflectionKey]map[string]*desc.FileDescriptor
+	fingerprint string
+	reportLock  *sync.RWMutex
+	lastReport  ReloadReport
+}
+
+// Snapshot returns the current registry. It never changes once returned,
+// callers that need several lookups to agree should use one snapshot.
+func (p *ProtoDescriptorLoader) Snapshot() *Registry {
+	return p.registry.Load()
 }
 
 func (p *ProtoDescriptorLoader) GetMessageDescriptor(name string) (*desc.MessageDescriptor, error) {
-	p.lock.RLock()
-	defer p.lock.RUnlock()
-	if desc, ok := p.messageDescMap[name]; ok {
-		return desc, nil
-	}
-	return nil, fmt.Errorf("message descriptor not found: %s", name)
+	return p.Snapshot().GetMessageDescriptor(name)
+}
+
+// ListMessageDescriptors returns all loaded message descriptors.
+func (p *ProtoDescriptorLoader) ListMessageDescriptors() []*desc.MessageDescriptor {
+	return p.Snapshot().ListMessageDescriptors()
 }
 
 func (p *ProtoDescriptorLoader) GetEnumDescriptor(name string) (*desc.EnumDescriptor, error) {
-	p.lock.RLock()
-	defer p.lock.RUnlock()
-	if desc, ok := p.enumDescMap[name]; ok {
-		return desc, nil
-	}
-	return nil, fmt.Errorf("enum descriptor not found: %s", name)
+	return p.Snapshot().GetEnumDescriptor(name)
+}
+
+func (p *ProtoDescriptorLoader) GetServiceDescriptor(name string) (*desc.ServiceDescriptor, error) {
+	return p.Snapshot().GetServiceDescriptor(name)
+}
+
+// GetMethodDescriptor looks up a method by "pkg.Service/Method" or
+// "pkg.Service.Method".
+func (p *ProtoDescriptorLoader) GetMethodDescriptor(name string) (*desc.MethodDescriptor, error) {
+	return p.Snapshot().GetMethodDescriptor(name)
 }
 
+// Start loads the proto files and keeps them up to date: by watching the
+// load folder when watching is enabled, and by polling every reload
+// interval as a fallback for file systems without change notifications.
 func (p *ProtoDescriptorLoader) Start() error {
-	err := p.Load()
-	if err != nil {
-		return err
+	_, err := p.reload(TriggerStart, nil, false)
+	if p.opts.Watch {
+		if werr := p.startWatcher(); werr != nil {
+			log.Log.WithError(werr).Error("unable to watch proto files, falling back to interval reload")
+		}
 	}
-	if p.reloadInterval > 0 {
+	if p.opts.ReloadInterval > 0 {
 		go func() {
-			for {
-				t := time.NewTimer(time.Duration(p.reloadInterval) * time.Minute) // minute
-				select {
-				case <-t.C:
-					err := p.Load()
-					if err != nil {
-						log.Log.WithError(err).Error("error loading proto files")
-					}
-				}
+			ticker := time.NewTicker(time.Duration(p.opts.ReloadInterval) * time.Minute) // minute
+			defer ticker.Stop()
+			for range ticker.C {
+				p.reload(TriggerInterval, nil, true)
 			}
 		}()
 	}
-
-	return nil
+	return err
 }
 
+// Load parses all proto files of the load folder into a new registry and
+// swaps it in. On failure the current registry is kept.
 func (p *ProtoDescriptorLoader) Load() error {
-	var pfs []string
-	fullLoadFolder := path.Join(p.importPath, p.loadFolder)
-	preImportPathLen := len(p.importPath) + 1
-	err := WalkDepth(fullLoadFolder, 10, func(dir, name string, isDir bool) error {
-		if !isDir && strings.HasSuffix(name, ".proto") {
-			relativePath := path.Join(dir, name)[preImportPathLen:]
-			pfs = append(pfs, relativePath)
-		}
-		return nil
-	})
+	_, err := p.reload(TriggerManual, nil, false)
+	return err
+}
+
+// LastReload returns the report of the latest load attempt.
+func (p *ProtoDescriptorLoader) LastReload() ReloadReport {
+	p.reportLock.RLock()
+	defer p.reportLock.RUnlock()
+	return p.lastReport
+}
+
+// reload loads the proto files and records a report. With onlyChanged the
+// files are only parsed when they differ from the last successful load; it
+// reports whether the files were parsed.
+func (p *ProtoDescriptorLoader) reload(trigger string, changed []string, onlyChanged bool) (bool, error) {
+	p.loadLock.Lock()
+	defer p.loadLock.Unlock()
+	return p.reloadLocked(trigger, changed, onlyChanged)
+}
+
+func (p *ProtoDescriptorLoader) reloadLocked(trigger string, changed []string, onlyChanged bool) (bool, error) {
+	diags := new(diagnostics)
+	pfs, fingerprint, err := p.scan()
+	remote, remoteFingerprint := p.fetchReflection(diags)
+	fingerprint += remoteFingerprint
+	if err == nil && onlyChanged && fingerprint == p.fingerprint {
+		return false, nil
+	}
+	if err == nil {
+		err = p.load(pfs, remote, diags)
+	}
+	if err == nil {
+		// a failed load is retried even if the files stay the same
+		p.fingerprint = fingerprint
+	}
+
+	report := ReloadReport{
+		Time:        time.Now(),
+		Trigger:     trigger,
+		Files:       changed,
+		Diagnostics: diags.list,
+		Generation:  p.Snapshot().Generation,
+	}
 	if err != nil {
-		return err
+		report.Error = err.Error()
+		log.Log.WithError(err).Error("error loading proto files, trigger=", trigger, " ,changed=", changed)
 	}
-	if len(pfs) == 0 {
-		return fmt.Errorf("no proto files found")
+	for _, d := range diags.list {
+		if d.Severity == SeverityWarning {
+			log.Log.Warn("proto warning: ", d)
+		}
 	}
+	p.reportLock.Lock()
+	p.lastReport = report
+	p.reportLock.Unlock()
+	return true, err
+}
 
-	fileDesc, err := p.parser.ParseFiles(pfs...)
+// load builds a registry from files and remote and swaps it in.
+func (p *ProtoDescriptorLoader) load(files []schemaFile, remote []remoteFile, diags *diagnostics) error {
+	registry, err := p.build(files, remote, nil, diags)
 	if err != nil {
 		return err
 	}
+	p.registry.Store(registry)
 
-	p.fileDesc = fileDesc
+	log.Log.Info("loaded proto", " ,generation=", registry.Generation, " ,namespaces=", registry.Namespaces(), " ,msgs=", registry.MessageNames())
+	return nil
+}
 
-	p.lock.Lock()
-	defer p.lock.Unlock()
+// build builds a registry for every namespace of files and remote, reading
+// files from ov before the disk. Problems are added to diags; the returned
+// error is a *DiagnosticsError if any of them is an error.
+func (p *ProtoDescriptorLoader) build(files []schemaFile, remote []remoteFile, ov overlay, diags *diagnostics) (*Registry, error) {
+	if len(files) == 0 && len(remote) == 0 {
+		return nil, fmt.Errorf("no proto files found")
+	}
 
-	var keys []string
-	for _, fd := range fileDesc {
-		for _, v := range fd.GetMessageTypes() {
-			p.messageDescMap[v.GetFullyQualifiedName()] = v
+	nsFiles := make(map[string][]schemaFile)
+	nsRemote := make(map[string][]remoteFile)
+	for _, f := range files {
+		nsFiles[f.ns] = append(nsFiles[f.ns], f)
+	}
+	for _, f := range remote {
+		nsRemote[f.ns] = append(nsRemote[f.ns], f)
+	}
+	namespaces := make(map[string]*Registry)
+	generation := p.Snapshot().Generation + 1
+	for _, ns := range append(mapKeys(nsFiles), mapKeys(nsRemote)...) {
+		if _, ok := namespaces[ns]; ok {
+			continue
+		}
+		fileDesc, sources := p.buildNamespace(ns, nsFiles[ns], nsRemote[ns], ov, diags)
+		namespaces[ns] = newRegistry(generation, ns, fileDesc, sources)
+	}
+	if err := diags.err(); err != nil {
+		return nil, err
+	}
+	registry, ok := namespaces[DefaultNamespace]
+	if !ok {
+		registry = newRegistry(generation, DefaultNamespace, nil, nil)
+		namespaces[DefaultNamespace] = registry
+	}
+	registry.namespaces = namespaces
+	return registry, nil
+}
+
+// buildNamespace parses the proto sources and reads the descriptor sets
+// among files, merged with the remote files fetched by reflection. Sources
+// may import files provided by descriptor sets or remote files; a file
+// present in several is taken from source, then from a descriptor set.
+func (p *ProtoDescriptorLoader) buildNamespace(ns string, files []schemaFile, remote []remoteFile, ov overlay, diags *diagnostics) ([]*desc.FileDescriptor, map[string]string) {
+	var pfs []string
+	setFiles := make(map[string]*desc.FileDescriptor)
+	sources := make(map[string]string)
+	for _, f := range remote {
+		setFiles[f.fd.GetName()] = f.fd
+		sources[f.fd.GetName()] = f.source
+	}
+	for _, f := range files {
+		if !isDescriptorSet(f.name) {
+			pfs = append(pfs, f.name)
+			sources[f.name] = f.name
+			continue
 		}
-		for _, v := range fd.GetEnumTypes() {
-			p.enumDescMap[v.GetFullyQualifiedName()] = v
+		data, err := ov.readFile(f.path)
+		if err == nil {
+			var fds map[string]*desc.FileDescriptor
+			if fds, err = parseDescriptorSet(data); err == nil {
+				for name, fd := range fds {
+					setFiles[name] = fd
+					sources[name] = f.name
+				}
+				continue
+			}
+			err = fmt.Errorf("invalid descriptor set: %v", err)
 		}
+		diags.add(ns, f.name, SeverityError, err)
 	}
-	p.lastLoadTIme = time.Now()
 
-	log.Log.Info("loaded proto", " ,files=", pfs, " ,msgs=", keys)
-	return nil
+	var fileDesc []*desc.FileDescriptor
+	if len(pfs) > 0 {
+		errorReporter, warningReporter := diags.reporters(ns)
+		parser := &protoparse.Parser{
+			ImportPaths: p.importPaths(ns),
+			Accessor:    ov.open,
+			LookupImport: func(name string) (*desc.FileDescriptor, error) {
+				if fd, ok := setFiles[name]; ok {
+					return fd, nil
+				}
+				return nil, os.ErrNotExist
+			},
+			ErrorReporter:   errorReporter,
+			WarningReporter: warningReporter,
+		}
+		var err error
+		fileDesc, err = parser.ParseFiles(pfs...)
+		if err != nil && !errors.Is(err, protoparse.ErrInvalidSource) {
+			// not reported with a position, e.g. a missing import
+			diags.add(ns, "", SeverityError, err)
+		}
+		if err != nil {
+			return nil, sources
+		}
+	}
+	parsed := make(map[string]bool)
+	for _, fd := range fileDesc {
+		parsed[fd.GetName()] = true
+	}
+	setNames := make([]string, 0, len(setFiles))
+	for name := range setFiles {
+		if !parsed[name] {
+			setNames = append(setNames, name)
+		}
+	}
+	sort.Strings(setNames)
+	for _, name := range setNames {
+		fileDesc = append(fileDesc, setFiles[name])
+	}
+	return withDependencies(fileDesc), sources
+}
+
+func mapKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 func (p *ProtoDescriptorLoader) ListFileDescriptor() []*desc.FileDescriptor {
-	return p.fileDesc
+	return p.Snapshot().ListFileDescriptor()
 }
 
-func (p *ProtoDescriptorLoader) AddFile(fileName string, file multipart.File) error {
-	fileContext, _ := ioutil.ReadAll(file)
-	realFilePath := path.Join(p.importPath, p.loadFolder, fileName)
-	if err := os.Remove(realFilePath); err == nil {
-		log.Log.Info("remove old file", "file=", realFilePath)
+// AddFiles stores uploaded files, keyed by file name, in the first root of
+// the namespace ns and reloads. A namespace without roots is created as a
+// sub folder of the first root with namespace folders. The files are
+// checked first: if the schemas don't compile with them nothing is written
+// and a *DiagnosticsError is returned.
+func (p *ProtoDescriptorLoader) AddFiles(ns string, files map[string][]byte) error {
+	p.loadLock.Lock()
+	defer p.loadLock.Unlock()
+
+	root, created, err := p.uploadFolder(ns)
+	if err != nil {
+		return err
+	}
+	if err := p.checkUpload(root, files); err != nil {
+		if created {
+			os.Remove(root.Path)
+		}
+		return err
+	}
+
+	// the files are written next to their destination and renamed over it
+	// once all are written, so a failed write keeps the old files
+	tmpFiles := make(map[string]string)
+	defer func() {
+		for tmp := range tmpFiles {
+			os.Remove(tmp)
+		}
+	}()
+	for fileName, fileContext := range files {
+		tmp, err := writeTemp(root.Path, fileContext)
+		if err != nil {
+			return err
+		}
+		tmpFiles[tmp] = filepath.Join(root.Path, path.Base(fileName))
 	}
-	err := ioutil.WriteFile(path.Join(p.importPath, p.loadFolder, fileName), fileContext, 0644)
+	var changed []string
+	for tmp, realFilePath := range tmpFiles {
+		if err := os.Rename(tmp, realFilePath); err != nil {
+			return err
+		}
+		delete(tmpFiles, tmp)
+		name, _ := p.nameOf(ns, realFilePath)
+		changed = append(changed, qualifiedName(ns, name))
+	}
+	sort.Strings(changed)
+	_, err = p.reloadLocked(TriggerUpload, changed, false)
+	return err
+}
+
+// writeTemp writes data to a new temporary file in dir, named so that it is
+// not taken for a schema file.
+func writeTemp(dir string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, ".upload-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// checkUpload builds the schemas as if files were stored in root. Files the
+// root's Include and Exclude leave out are rejected, as they wouldn't be
+// loaded.
+func (p *ProtoDescriptorLoader) checkUpload(root Root, files map[string][]byte) error {
+	scanned, _, err := p.scan()
 	if err != nil {
 		return err
 	}
-	return p.Load()
+	ns := root.Namespace
+	ov := make(overlay)
+	for fileName, fileContext := range files {
+		base := path.Base(fileName)
+		if !root.match(base) {
+			return fmt.Errorf("%s is excluded by the Include and Exclude of %s", base, root.Path)
+		}
+		realFilePath := filepath.Join(root.Path, base)
+		ov[ov.key(realFilePath)] = fileContext
+		name, ok := p.nameOf(ns, realFilePath)
+		if !ok {
+			return fmt.Errorf("%s is outside of the import paths", realFilePath)
+		}
+		found := false
+		for _, f := range scanned {
+			found = found || (f.ns == ns && f.name == name)
+		}
+		if !found {
+			scanned = append(scanned, schemaFile{ns: ns, name: name, path: realFilePath})
+		}
+	}
+	_, err = p.build(scanned, p.cachedReflection(), ov, new(diagnostics))
+	return err
 }
 
-func (p *ProtoDescriptorLoader) DelFile(fileName string) error {
-	if !strings.HasPrefix(fileName, p.loadFolder) {
-		return fmt.Errorf("invalid file name")
+func (p *ProtoDescriptorLoader) DelFile(ns, fileName string) error {
+	realFilePath, err := p.filePath(ns, fileName)
+	if err != nil {
+		return err
 	}
-	realFilePath := path.Join(p.importPath, fileName)
 	if err := os.Remove(realFilePath); err != nil {
 		return err
 	}
-	return p.Load()
+	_, err = p.reload(TriggerDelete, []string{qualifiedName(ns, fileName)}, false)
+	return err
 }
 
-func (p *ProtoDescriptorLoader) ReadFile(fileName string) (string, error) {
-	if !strings.HasPrefix(fileName, p.loadFolder) {
-		return "", fmt.Errorf("invalid file name")
+func (p *ProtoDescriptorLoader) ReadFile(ns, fileName string) (string, error) {
+	realFilePath, err := p.filePath(ns, fileName)
+	if err != nil {
+		return "", err
 	}
-	realFilePath := path.Join(p.importPath, fileName)
 	file, err := os.Open(realFilePath)
 	if err != nil {
 		return "", err
@@ -176,5 +444,12 @@ func (p *ProtoDescriptorLoader) ReadFile(fileName string) (string, error) {
 	defer file.Close()
 
 	fileContext, _ := ioutil.ReadAll(file)
+	if isDescriptorSet(fileName) {
+		files, err := parseDescriptorSet(fileContext)
+		if err != nil {
+			return "", err
+		}
+		return printDescriptorSet(files)
+	}
 	return string(fileContext), nil
 }
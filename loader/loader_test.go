@@ -0,0 +1,123 @@
+package loader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadRetriesFailedLoad(t *testing.T) {
+	root, imports := t.TempDir(), t.TempDir()
+	writeFile(t, filepath.Join(root, "a.proto"), `syntax = "proto3"; import "dep.proto"; message A { Dep dep = 1; }`)
+	InitLoader(Options{ImportPaths: []string{root, imports}, Roots: []Root{{Path: root}}})
+	p := GetLocalLoader()
+
+	if reloaded, err := p.reload(TriggerInterval, nil, true); !reloaded || err == nil {
+		t.Fatalf("reload with a missing import = %v, %v, want a failed reload", reloaded, err)
+	}
+	// the import is outside of the roots, so the fingerprint stays the same
+	writeFile(t, filepath.Join(imports, "dep.proto"), `syntax = "proto3"; message Dep {}`)
+	if reloaded, err := p.reload(TriggerInterval, nil, true); !reloaded || err != nil {
+		t.Fatalf("retried reload = %v, %v", reloaded, err)
+	}
+	if _, err := p.GetMessageDescriptor("A"); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := p.reload(TriggerInterval, nil, true); reloaded || err != nil {
+		t.Errorf("reload of unchanged files = %v, %v, want it skipped", reloaded, err)
+	}
+}
+
+func TestAddFiles(t *testing.T) {
+	root := t.TempDir()
+	const good = `syntax = "proto3"; package a; message A { string name = 1; }`
+	writeFile(t, filepath.Join(root, "a.proto"), good)
+	writeFile(t, filepath.Join(root, "keep.proto"), `syntax = "proto3"; package k; message K {}`)
+	InitLoader(Options{ImportPaths: []string{root}, Roots: []Root{{Path: root, Exclude: []string{"skip_*.proto"}}}})
+	p := GetLocalLoader()
+	if err := p.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		wantErr  string
+		wantDiag bool
+	}{
+		{"syntax error", map[string]string{"a.proto": `syntax = "proto3"; message A { strin name = 1; }`}, "", true},
+		{"breaks an import", map[string]string{"b.proto": `syntax = "proto3"; import "nope.proto";`}, "", true},
+		{"duplicate type", map[string]string{"b.proto": `syntax = "proto3"; package k; message K {}`}, "", true},
+		{"one of two bad", map[string]string{"a.proto": good, "b.proto": `syntax = "proto3"; message {`}, "", true},
+		{"excluded", map[string]string{"skip_b.proto": `syntax = "proto3"; message B {}`}, "excluded", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := make(map[string][]byte)
+			for name, content := range tt.files {
+				files[name] = []byte(content)
+			}
+			generation := p.Snapshot().Generation
+			err := p.AddFiles(DefaultNamespace, files)
+			if err == nil {
+				t.Fatal("AddFiles succeeded")
+			}
+			var diagErr *DiagnosticsError
+			if isDiag := errors.As(err, &diagErr); isDiag != tt.wantDiag || (isDiag && len(diagErr.Diagnostics) == 0) {
+				t.Errorf("AddFiles error = %#v, want diagnostics %v", err, tt.wantDiag)
+			}
+			if tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("AddFiles error = %v, want %q", err, tt.wantErr)
+			}
+
+			if data, err := os.ReadFile(filepath.Join(root, "a.proto")); err != nil || string(data) != good {
+				t.Errorf("a.proto = %q, %v, want it kept", data, err)
+			}
+			entries, _ := os.ReadDir(root)
+			if len(entries) != 2 {
+				t.Errorf("files in the root = %v, want a.proto and keep.proto only", entries)
+			}
+			if p.Snapshot().Generation != generation {
+				t.Errorf("registry reloaded")
+			}
+		})
+	}
+
+	// a write that fails leaves no temporary files behind
+	writeFile(t, filepath.Join(root, "c.proto", "x"), "")
+	files := map[string][]byte{"c.proto": []byte(`syntax = "proto3"; message C {}`)}
+	if err := p.AddFiles(DefaultNamespace, files); err == nil {
+		t.Errorf("AddFiles over a folder succeeded")
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 3 {
+		t.Errorf("files in the root = %v, want no temporary files", entries)
+	}
+	os.RemoveAll(filepath.Join(root, "c.proto"))
+
+	updated := `syntax = "proto3"; package a; message A { string name = 1; int32 age = 2; }`
+	if err := p.AddFiles(DefaultNamespace, map[string][]byte{"dir/a.proto": []byte(updated)}); err != nil {
+		t.Fatalf("AddFiles: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "a.proto")); string(data) != updated {
+		t.Errorf("a.proto = %q, want it replaced", data)
+	}
+	md, err := p.GetMessageDescriptor("a.A")
+	if err != nil || md.FindFieldByName("age") == nil {
+		t.Errorf("a.A not reloaded: %v", err)
+	}
+	if report := p.LastReload(); report.Trigger != TriggerUpload || len(report.Files) != 1 || report.Files[0] != "a.proto" {
+		t.Errorf("report = %+v", report)
+	}
+}
@@ -0,0 +1,50 @@
+package loader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoprint"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// IsSchemaFile reports whether the loader reads name: a proto source or a
+// compiled descriptor set as written by protoc --descriptor_set_out.
+func IsSchemaFile(name string) bool {
+	return strings.HasSuffix(name, ".proto") || isDescriptorSet(name)
+}
+
+func isDescriptorSet(name string) bool {
+	return strings.HasSuffix(name, ".protoset") || strings.HasSuffix(name, ".pb")
+}
+
+func parseDescriptorSet(data []byte) (map[string]*desc.FileDescriptor, error) {
+	fds := new(descriptorpb.FileDescriptorSet)
+	if err := proto.Unmarshal(data, fds); err != nil {
+		return nil, err
+	}
+	return desc.CreateFileDescriptorsFromSet(fds)
+}
+
+// printDescriptorSet renders the files of a descriptor set as proto source.
+func printDescriptorSet(files map[string]*desc.FileDescriptor) (string, error) {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	printer := &protoprint.Printer{}
+	for _, name := range names {
+		fmt.Fprintf(&sb, "// file: %s\n", name)
+		if err := printer.PrintProtoFile(files[name], &sb); err != nil {
+			return "", err
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
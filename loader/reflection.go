@@ -0,0 +1,155 @@
+package loader
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/grpcreflect"
+	"github.com/zzong12/hprotoxy/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/protobuf/proto"
+)
+
+// reflectionTimeout bounds a fetch from a reflection source.
+var reflectionTimeout = 10 * time.Second
+
+// ReflectionSource is a gRPC server whose schemas are downloaded through
+// server reflection on every load.
+type ReflectionSource struct {
+	// Target is the address of the server, e.g. "localhost:9090".
+	Target string
+	// TLS is used to connect to the server, nil means plaintext.
+	TLS *tls.Config
+	// Namespace the files are loaded into.
+	Namespace string
+}
+
+// remoteFile is a file fetched from a reflection source.
+type remoteFile struct {
+	ns     string
+	source string
+	fd     *desc.FileDescriptor
+}
+
+// reflectionScheme prefixes the source of files from reflection sources.
+const reflectionScheme = "grpc://"
+
+func (s ReflectionSource) source() string {
+	return reflectionScheme + s.Target
+}
+
+// reflectionKey identifies the files fetched for a source: the same server
+// may be loaded into several namespaces.
+type reflectionKey struct {
+	ns     string
+	target string
+}
+
+func (s ReflectionSource) key() reflectionKey {
+	return reflectionKey{ns: s.Namespace, target: s.Target}
+}
+
+// AddReflectionSource registers a server to fetch schemas from. Must be
+// called before Start.
+func (p *ProtoDescriptorLoader) AddReflectionSource(src ReflectionSource) {
+	p.reflection = append(p.reflection, src)
+}
+
+// fetch downloads the files of all services the server exposes, along with
+// their dependencies.
+func (s ReflectionSource) fetch() (map[string]*desc.FileDescriptor, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), reflectionTimeout)
+	defer cancel()
+
+	creds := insecure.NewCredentials()
+	if s.TLS != nil {
+		creds = credentials.NewTLS(s.TLS)
+	}
+	conn, err := grpc.DialContext(ctx, s.Target, grpc.WithTransportCredentials(creds), grpc.WithBlock())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.source(), err)
+	}
+	defer conn.Close()
+
+	client := grpcreflect.NewClient(ctx, rpb.NewServerReflectionClient(conn))
+	defer client.Reset()
+	services, err := client.ListServices()
+	if err != nil {
+		return nil, fmt.Errorf("%s: list services: %v", s.source(), err)
+	}
+
+	files := make(map[string]*desc.FileDescriptor)
+	var add func(fd *desc.FileDescriptor)
+	add = func(fd *desc.FileDescriptor) {
+		if _, ok := files[fd.GetName()]; ok {
+			return
+		}
+		files[fd.GetName()] = fd
+		for _, dep := range fd.GetDependencies() {
+			add(dep)
+		}
+	}
+	for _, svc := range services {
+		if strings.HasPrefix(svc, "grpc.reflection.") {
+			continue
+		}
+		fd, err := client.FileContainingSymbol(svc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: resolve %s: %v", s.source(), svc, err)
+		}
+		add(fd)
+	}
+	return files, nil
+}
+
+// fetchReflection downloads the files of all reflection sources. A source
+// that can't be reached keeps the files of its previous fetch and is
+// reported as a warning. The fingerprint changes whenever a downloaded file
+// does.
+func (p *ProtoDescriptorLoader) fetchReflection(diags *diagnostics) ([]remoteFile, string) {
+	if p.reflected == nil {
+		p.reflected = make(map[reflectionKey]map[string]*desc.FileDescriptor)
+	}
+	for _, src := range p.reflection {
+		fds, err := src.fetch()
+		if err != nil {
+			log.Log.WithError(err).Error("error fetching schemas by reflection")
+			diags.add(src.Namespace, src.source(), SeverityWarning, err)
+			continue
+		}
+		p.reflected[src.key()] = fds
+	}
+
+	files := p.cachedReflection()
+	if len(files) == 0 {
+		return nil, ""
+	}
+	h := sha256.New()
+	for _, f := range files {
+		b, _ := proto.MarshalOptions{Deterministic: true}.Marshal(f.fd.AsFileDescriptorProto())
+		fmt.Fprintf(h, "%s:%s:%d;", f.ns, f.fd.GetName(), len(b))
+		h.Write(b)
+	}
+	return files, fmt.Sprintf("reflection:%x;", h.Sum(nil))
+}
+
+// cachedReflection returns the files of the latest successful fetch of
+// every reflection source.
+func (p *ProtoDescriptorLoader) cachedReflection() []remoteFile {
+	var files []remoteFile
+	for _, src := range p.reflection {
+		fds := p.reflected[src.key()]
+		for _, name := range mapKeys(fds) {
+			files = append(files, remoteFile{ns: src.Namespace, source: src.source(), fd: fds[name]})
+		}
+	}
+	return files
+}
@@ -0,0 +1,106 @@
+package loader
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// startReflectionServer serves the health service with reflection on a
+// local port and returns its address.
+func startReflectionServer(t *testing.T) (string, *grpc.Server) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	svr := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(svr, health.NewServer())
+	reflection.Register(svr)
+	go svr.Serve(lis)
+	t.Cleanup(svr.Stop)
+	return lis.Addr().String(), svr
+}
+
+func TestReflectionSource(t *testing.T) {
+	addr, svr := startReflectionServer(t)
+
+	InitLoader(Options{Roots: []Root{{Path: t.TempDir()}}})
+	p := GetLocalLoader()
+	p.AddReflectionSource(ReflectionSource{Target: addr, Namespace: "remote"})
+	if err := p.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	registry, err := p.Snapshot().Select("remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.GetMethodDescriptor("grpc.health.v1.Health/Check"); err != nil {
+		t.Errorf("health method not loaded: %v", err)
+	}
+	if _, err := registry.GetServiceDescriptor("grpc.reflection.v1alpha.ServerReflection"); err == nil {
+		t.Errorf("reflection service should be skipped")
+	}
+	md, err := registry.GetMessageDescriptor("grpc.health.v1.HealthCheckResponse")
+	if err != nil {
+		t.Fatalf("health message not loaded: %v", err)
+	}
+	if src := registry.Source(md.GetFile()); src != "grpc://"+addr {
+		t.Errorf("source = %q, want grpc://%s", src, addr)
+	}
+	if registry.IsLocal(md.GetFile()) {
+		t.Errorf("file from reflection is local")
+	}
+	if _, err := p.Snapshot().GetMessageDescriptor("grpc.health.v1.HealthCheckResponse"); err == nil {
+		t.Errorf("message should only be in namespace remote")
+	}
+
+	// a server that went away keeps its files and is reported as a warning
+	svr.Stop()
+	defer func(d time.Duration) { reflectionTimeout = d }(reflectionTimeout)
+	reflectionTimeout = time.Second
+	generation := p.Snapshot().Generation
+	if err := p.Load(); err != nil {
+		t.Fatalf("Load without server: %v", err)
+	}
+	if p.Snapshot().Generation == generation {
+		t.Errorf("generation not bumped")
+	}
+	registry, _ = p.Snapshot().Select("remote")
+	if _, err := registry.GetMessageDescriptor("grpc.health.v1.HealthCheckResponse"); err != nil {
+		t.Errorf("cached files lost: %v", err)
+	}
+	report := p.LastReload()
+	if len(report.Diagnostics) != 1 || report.Diagnostics[0].Severity != SeverityWarning {
+		t.Errorf("diagnostics = %v, want one warning", report.Diagnostics)
+	}
+}
+
+func TestReflectionSourceNamespaces(t *testing.T) {
+	addr, _ := startReflectionServer(t)
+
+	InitLoader(Options{Roots: []Root{{Path: t.TempDir()}}})
+	p := GetLocalLoader()
+	p.AddReflectionSource(ReflectionSource{Target: addr, Namespace: "a"})
+	p.AddReflectionSource(ReflectionSource{Target: addr, Namespace: "b"})
+	if err := p.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(p.reflected) != 2 {
+		t.Errorf("fetched files of %d sources, want 2", len(p.reflected))
+	}
+	for _, ns := range []string{"a", "b"} {
+		registry, err := p.Snapshot().Select(ns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := registry.GetMethodDescriptor("grpc.health.v1.Health/Check"); err != nil {
+			t.Errorf("namespace %s: %v", ns, err)
+		}
+	}
+}
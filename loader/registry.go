@@ -0,0 +1,154 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+)
+
+// Registry is an immutable index of the descriptors produced by one load.
+// A new registry is built on every successful load and swapped in as a
+// whole, so readers holding one always see a consistent set of types.
+type Registry struct {
+	// Generation is incremented on every successful load, 0 is the empty
+	// registry before the first load.
+	Generation uint64
+	LoadTime   time.Time
+	Namespace  string
+
+	// namespaces holds the registries of all namespaces, it is only set
+	// on the registry of the default namespace.
+	namespaces     map[string]*Registry
+	files          []*desc.FileDescriptor
+	sources        map[string]string
+	enumDescMap    map[string]*desc.EnumDescriptor
+	messageDescMap map[string]*desc.MessageDescriptor
+	serviceDescMap map[string]*desc.ServiceDescriptor
+	methodDescMap  map[string]*desc.MethodDescriptor
+}
+
+func newRegistry(generation uint64, ns string, files []*desc.FileDescriptor, sources map[string]string) *Registry {
+	r := &Registry{
+		Generation:     generation,
+		LoadTime:       time.Now(),
+		Namespace:      ns,
+		files:          files,
+		sources:        sources,
+		enumDescMap:    make(map[string]*desc.EnumDescriptor),
+		messageDescMap: make(map[string]*desc.MessageDescriptor),
+		serviceDescMap: make(map[string]*desc.ServiceDescriptor),
+		methodDescMap:  make(map[string]*desc.MethodDescriptor),
+	}
+	for _, fd := range files {
+		for _, v := range FileMessages(fd) {
+			r.messageDescMap[v.GetFullyQualifiedName()] = v
+		}
+		for _, v := range FileEnums(fd) {
+			r.enumDescMap[v.GetFullyQualifiedName()] = v
+		}
+		for _, v := range fd.GetServices() {
+			r.serviceDescMap[v.GetFullyQualifiedName()] = v
+			for _, m := range v.GetMethods() {
+				r.methodDescMap[m.GetFullyQualifiedName()] = m
+			}
+		}
+	}
+	return r
+}
+
+// Select returns the registry of the namespace ns. r must be the registry
+// returned by Snapshot.
+func (r *Registry) Select(ns string) (*Registry, error) {
+	if ns == r.Namespace {
+		return r, nil
+	}
+	if nr, ok := r.namespaces[ns]; ok {
+		return nr, nil
+	}
+	return nil, fmt.Errorf("namespace not found: %s", ns)
+}
+
+// Namespaces returns the names of all namespaces, the default one first.
+func (r *Registry) Namespaces() []string {
+	if len(r.namespaces) == 0 {
+		return []string{r.Namespace}
+	}
+	return mapKeys(r.namespaces)
+}
+
+func (r *Registry) ListFileDescriptor() []*desc.FileDescriptor {
+	return r.files
+}
+
+// Source returns the schema file fd was loaded from, relative to the import
+// path: the proto source itself or the descriptor set containing it.
+func (r *Registry) Source(fd *desc.FileDescriptor) string {
+	if src, ok := r.sources[fd.GetName()]; ok {
+		return src
+	}
+	return fd.GetName()
+}
+
+// HasSource reports whether fd was loaded from a schema file or reflection
+// source of the registry, rather than only added as a dependency of one.
+func (r *Registry) HasSource(fd *desc.FileDescriptor) bool {
+	_, ok := r.sources[fd.GetName()]
+	return ok
+}
+
+// IsLocal reports whether fd was loaded from a schema file on disk, rather
+// than from a reflection source or as a dependency.
+func (r *Registry) IsLocal(fd *desc.FileDescriptor) bool {
+	src, ok := r.sources[fd.GetName()]
+	return ok && !strings.HasPrefix(src, reflectionScheme)
+}
+
+// ListMessageDescriptors returns all message descriptors of the registry.
+func (r *Registry) ListMessageDescriptors() []*desc.MessageDescriptor {
+	res := make([]*desc.MessageDescriptor, 0, len(r.messageDescMap))
+	for _, md := range r.messageDescMap {
+		res = append(res, md)
+	}
+	return res
+}
+
+// MessageNames returns the fully qualified names of all message types.
+func (r *Registry) MessageNames() []string {
+	res := make([]string, 0, len(r.messageDescMap))
+	for name := range r.messageDescMap {
+		res = append(res, name)
+	}
+	return res
+}
+
+func (r *Registry) GetMessageDescriptor(name string) (*desc.MessageDescriptor, error) {
+	if desc, ok := r.messageDescMap[name]; ok {
+		return desc, nil
+	}
+	return nil, fmt.Errorf("message descriptor not found: %s", name)
+}
+
+func (r *Registry) GetEnumDescriptor(name string) (*desc.EnumDescriptor, error) {
+	if desc, ok := r.enumDescMap[name]; ok {
+		return desc, nil
+	}
+	return nil, fmt.Errorf("enum descriptor not found: %s", name)
+}
+
+func (r *Registry) GetServiceDescriptor(name string) (*desc.ServiceDescriptor, error) {
+	if desc, ok := r.serviceDescMap[name]; ok {
+		return desc, nil
+	}
+	return nil, fmt.Errorf("service descriptor not found: %s", name)
+}
+
+// GetMethodDescriptor looks up a method by "pkg.Service/Method" or
+// "pkg.Service.Method".
+func (r *Registry) GetMethodDescriptor(name string) (*desc.MethodDescriptor, error) {
+	if desc, ok := r.methodDescMap[methodName(name)]; ok {
+		return desc, nil
+	}
+	return nil, fmt.Errorf("method descriptor not found: %s", name)
+}
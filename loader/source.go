@@ -0,0 +1,253 @@
+package loader
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Options configures the loader.
+type Options struct {
+	// ImportPaths are searched in order when resolving imports. Files are
+	// named relative to the first import path containing them; a root
+	// outside of all import paths is an import path itself. The well-known
+	// google/protobuf/*.proto files need not be present in any of them.
+	ImportPaths    []string
+	Roots          []Root
+	ReloadInterval uint16
+	Watch          bool
+}
+
+// DefaultNamespace is the namespace of roots that don't name one.
+const DefaultNamespace = ""
+
+// NamespaceFolders as the namespace of a root makes every sub folder of the
+// root a namespace named after the folder.
+const NamespaceFolders = "*"
+
+// Root is a folder whose schema files are loaded. Include and Exclude are
+// globs matched against the path of a file relative to the root, "**"
+// matches any number of folders and a glob without "/" matches the base
+// name. Without Include all schema files are loaded.
+type Root struct {
+	Path string
+	// Namespace the files are loaded into. Each namespace is loaded on its
+	// own, so namespaces may define the same types differently. With
+	// NamespaceFolders every sub folder is a namespace and the first import
+	// path of its files.
+	Namespace string
+	Include   []string
+	Exclude   []string
+
+	nsFolder bool
+}
+
+func (r Root) match(rel string) bool {
+	included := len(r.Include) == 0
+	for _, pattern := range r.Include {
+		if matchGlob(pattern, rel) {
+			included = true
+			break
+		}
+	}
+	if !included {
+		return false
+	}
+	for _, pattern := range r.Exclude {
+		if matchGlob(pattern, rel) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchGlob matches name against pattern, see Root.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// schemaFile is a file found in one of the roots.
+type schemaFile struct {
+	ns string
+	// name is relative to its import path, as used in imports.
+	name string
+	path string
+}
+
+// qualifiedName names a file of the namespace ns in reports.
+func qualifiedName(ns, name string) string {
+	if ns == DefaultNamespace {
+		return name
+	}
+	return ns + ":" + name
+}
+
+// roots returns the configured roots with namespace folders expanded.
+func (p *ProtoDescriptorLoader) roots() []Root {
+	var roots []Root
+	for _, root := range p.opts.Roots {
+		if root.Namespace != NamespaceFolders {
+			roots = append(roots, root)
+			continue
+		}
+		entries, err := os.ReadDir(root.Path)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if e.IsDir() {
+				sub := root
+				sub.Path = filepath.Join(root.Path, e.Name())
+				sub.Namespace = e.Name()
+				sub.nsFolder = true
+				roots = append(roots, sub)
+			}
+		}
+	}
+	return roots
+}
+
+// importPaths returns the import paths of the namespace ns: its namespace
+// folders, the configured import paths and its roots outside of them.
+func (p *ProtoDescriptorLoader) importPaths(ns string) []string {
+	var paths, outside []string
+	for _, root := range p.roots() {
+		if root.Namespace != ns {
+			continue
+		}
+		if root.nsFolder {
+			paths = append(paths, root.Path)
+		} else if _, ok := relativeTo(p.opts.ImportPaths, root.Path); !ok {
+			outside = append(outside, root.Path)
+		}
+	}
+	paths = append(paths, p.opts.ImportPaths...)
+	return append(paths, outside...)
+}
+
+// nameOf returns the name of the file at filePath in the namespace ns,
+// relative to the first import path containing it.
+func (p *ProtoDescriptorLoader) nameOf(ns, filePath string) (string, bool) {
+	return relativeTo(p.importPaths(ns), filePath)
+}
+
+// locate returns the namespace and name of the file at filePath.
+func (p *ProtoDescriptorLoader) locate(filePath string) (string, string, bool) {
+	for _, root := range p.roots() {
+		if _, ok := relativeTo([]string{root.Path}, filePath); ok {
+			name, ok := p.nameOf(root.Namespace, filePath)
+			return root.Namespace, name, ok
+		}
+	}
+	return "", "", false
+}
+
+func relativeTo(dirs []string, filePath string) (string, bool) {
+	for _, dir := range dirs {
+		rel, err := filepath.Rel(dir, filePath)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return filepath.ToSlash(rel), true
+		}
+	}
+	return "", false
+}
+
+// scan lists the schema files of the roots along with a fingerprint of
+// their sizes and modification times.
+func (p *ProtoDescriptorLoader) scan() ([]schemaFile, string, error) {
+	var (
+		files       []schemaFile
+		fingerprint strings.Builder
+		seen        = make(map[string]bool)
+	)
+	for _, root := range p.roots() {
+		err := WalkDepth(root.Path, 10, func(dir, name string, isDir bool) error {
+			filePath := filepath.Join(dir, name)
+			if isDir || !IsSchemaFile(name) {
+				return nil
+			}
+			if rel, err := filepath.Rel(root.Path, filePath); err != nil || !root.match(filepath.ToSlash(rel)) {
+				return nil
+			}
+			fileName, ok := p.nameOf(root.Namespace, filePath)
+			if !ok || seen[qualifiedName(root.Namespace, fileName)] {
+				return nil
+			}
+			seen[qualifiedName(root.Namespace, fileName)] = true
+			files = append(files, schemaFile{ns: root.Namespace, name: fileName, path: filePath})
+			if fi, err := os.Stat(filePath); err == nil {
+				fmt.Fprintf(&fingerprint, "%s:%d:%d;", filePath, fi.Size(), fi.ModTime().UnixNano())
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return files, fingerprint.String(), nil
+}
+
+// filePath returns where the loaded file fileName of the namespace ns is
+// stored.
+func (p *ProtoDescriptorLoader) filePath(ns, fileName string) (string, error) {
+	files, _, err := p.scan()
+	if err != nil {
+		return "", err
+	}
+	for _, f := range files {
+		if f.ns == ns && f.name == fileName {
+			return f.path, nil
+		}
+	}
+	return "", fmt.Errorf("invalid file name")
+}
+
+// uploadFolder returns the root files uploaded to the namespace ns are
+// stored in, creating a namespace folder if needed.
+func (p *ProtoDescriptorLoader) uploadFolder(ns string) (root Root, created bool, err error) {
+	for _, root := range p.roots() {
+		if root.Namespace == ns {
+			return root, false, nil
+		}
+	}
+	if ns == DefaultNamespace || ns == "." || ns == ".." || strings.ContainsAny(ns, `/\:*`) {
+		return Root{}, false, fmt.Errorf("no folder for namespace %q", ns)
+	}
+	for _, root := range p.opts.Roots {
+		if root.Namespace == NamespaceFolders {
+			sub := root
+			sub.Path = filepath.Join(root.Path, ns)
+			sub.Namespace = ns
+			sub.nsFolder = true
+			return sub, true, os.MkdirAll(sub.Path, 0755)
+		}
+	}
+	return Root{}, false, fmt.Errorf("no folder for namespace %q", ns)
+}
@@ -0,0 +1,85 @@
+package loader
+
+import (
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/zzong12/hprotoxy/log"
+)
+
+// watchDebounce is how long the watcher waits for changes to settle before
+// reloading, so saving several files triggers a single reload.
+const watchDebounce = 500 * time.Millisecond
+
+// startWatcher watches the roots and their sub folders, reloading when
+// schema files change.
+func (p *ProtoDescriptorLoader) startWatcher() error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for _, root := range p.opts.Roots {
+		if err := watcher.Add(root.Path); err != nil {
+			watcher.Close()
+			return err
+		}
+		err = WalkDepth(root.Path, 10, func(dir, name string, isDir bool) error {
+			if isDir {
+				return watcher.Add(path.Join(dir, name))
+			}
+			return nil
+		})
+		if err != nil {
+			watcher.Close()
+			return err
+		}
+		log.Log.Info("watching proto files, folder=", root.Path)
+	}
+
+	go func() {
+		defer watcher.Close()
+		changed := make(map[string]struct{})
+		timer := time.NewTimer(watchDebounce)
+		timer.Stop()
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if ev.Op&fsnotify.Create != 0 {
+					if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+						watcher.Add(ev.Name)
+						continue
+					}
+				}
+				if !IsSchemaFile(ev.Name) || ev.Op == fsnotify.Chmod {
+					continue
+				}
+				if ns, name, ok := p.locate(ev.Name); ok {
+					changed[qualifiedName(ns, name)] = struct{}{}
+				}
+				timer.Reset(watchDebounce)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Log.WithError(err).Error("proto file watcher error")
+			case <-timer.C:
+				files := make([]string, 0, len(changed))
+				for f := range changed {
+					files = append(files, f)
+				}
+				sort.Strings(files)
+				changed = make(map[string]struct{})
+				if reloaded, err := p.reload(TriggerWatch, files, true); reloaded && err == nil {
+					log.Log.Info("reloaded proto files on change, files=", files)
+				}
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,87 @@
+package mitm
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func TestCertFor(t *testing.T) {
+	certPEM, keyPEM, err := GenerateCA("test ca", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := NewCA(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.CertPEM())
+
+	tests := []struct {
+		host string
+	}{
+		{"example.com"},
+		{"api.example.com"},
+		{"127.0.0.1"},
+		{"::1"},
+	}
+	for _, tt := range tests {
+		cert, err := ca.CertFor(tt.host)
+		if err != nil {
+			t.Fatalf("CertFor(%q): %v", tt.host, err)
+		}
+		_, err = cert.Leaf.Verify(x509.VerifyOptions{
+			DNSName:   tt.host,
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
+		if err != nil {
+			t.Errorf("CertFor(%q) does not verify: %v", tt.host, err)
+		}
+		if cert.Leaf.NotAfter.After(ca.cert.NotAfter) {
+			t.Errorf("CertFor(%q) outlives the ca: %v > %v", tt.host, cert.Leaf.NotAfter, ca.cert.NotAfter)
+		}
+		again, _ := ca.CertFor(tt.host)
+		if again != cert {
+			t.Errorf("CertFor(%q) is not cached", tt.host)
+		}
+	}
+}
+
+func TestNewCAErrors(t *testing.T) {
+	certPEM, keyPEM, err := GenerateCA("test ca", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := NewCA(certPEM, keyPEM)
+	leaf, _ := ca.CertFor("example.com")
+
+	tests := []struct {
+		name    string
+		certPEM []byte
+		keyPEM  []byte
+	}{
+		{"empty", nil, nil},
+		{"key mismatch", certPEM, []byte("not a key")},
+		{"not a ca", pemCert(leaf.Certificate[0]), leafKeyPEM(t, ca)},
+	}
+	for _, tt := range tests {
+		if _, err := NewCA(tt.certPEM, tt.keyPEM); err == nil {
+			t.Errorf("%s: NewCA succeeded", tt.name)
+		}
+	}
+}
+
+func pemCert(der []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func leafKeyPEM(t *testing.T, ca *CA) []byte {
+	der, err := x509.MarshalPKCS8PrivateKey(ca.leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
@@ -0,0 +1,53 @@
+package mitm
+
+import (
+	"io"
+	"net"
+	"sync"
+)
+
+// connListener is a net.Listener yielding a single connection, so a hijacked
+// connection can be served by an http.Server. Accept blocks after the first
+// call until that connection is closed.
+type connListener struct {
+	conn net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+// NewConnListener returns a listener that accepts conn once.
+func NewConnListener(conn net.Conn) net.Listener {
+	return &connListener{conn: conn, done: make(chan struct{})}
+}
+
+func (l *connListener) Accept() (net.Conn, error) {
+	var conn net.Conn
+	l.once.Do(func() {
+		conn = &notifyConn{Conn: l.conn, done: l.done}
+	})
+	if conn != nil {
+		return conn, nil
+	}
+	<-l.done
+	return nil, io.EOF
+}
+
+func (l *connListener) Close() error {
+	return nil
+}
+
+func (l *connListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+type notifyConn struct {
+	net.Conn
+	once sync.Once
+	done chan struct{}
+}
+
+func (c *notifyConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(func() { close(c.done) })
+	return err
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/zzong12/hprotoxy/log"
+	"github.com/zzong12/hprotoxy/mitm"
+)
+
+// serveProxy is the handler of the proxy port.
+func (s *Server) serveProxy(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		s.handleConnect(w, r)
+		return
+	}
+	if md := s.grpcMethod(r); md != nil {
+		s.grpc.serve(w, r, md)
+		return
+	}
+	s.proxyRequest(w, r)
+}
+
+// handleConnect accepts a CONNECT tunnel. With a CA configured the tunnel
+// is intercepted: TLS is terminated with a certificate minted for the host
+// and every request inside it runs through proxyRequest. Without a CA the
+// tunnel is relayed untouched.
+func (s *Server) handleConnect(w http.ResponseWriter, r *http.Request) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		writeErrorResponse(w, http.StatusInternalServerError, errHijackUnsupported)
+		return
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		log.Log.WithError(err).Error("unable to hijack connect request")
+		return
+	}
+	// the client may have sent data, like a ClientHello, right after the
+	// CONNECT headers; it is in the buffered reader.
+	conn = &bufferedConn{Conn: conn, r: rw.Reader}
+	if _, err := conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n")); err != nil {
+		conn.Close()
+		return
+	}
+
+	if s.ca == nil {
+		tunnel(conn, r.Host)
+		return
+	}
+
+	hostname := r.Host
+	if h, _, err := net.SplitHostPort(r.Host); err == nil {
+		hostname = h
+	}
+	tlsConn := tls.Server(conn, s.ca.TLSConfig(hostname))
+	if err := tlsConn.Handshake(); err != nil {
+		log.Log.WithError(err).Errorf("tls handshake with client failed, host=%s", r.Host)
+		conn.Close()
+		return
+	}
+
+	host := r.Host
+	if h, port, err := net.SplitHostPort(r.Host); err == nil && port == "443" {
+		host = h
+	}
+	svr := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req.URL.Scheme = "https"
+			req.URL.Host = host
+			s.proxyRequest(w, req)
+		}),
+		ReadHeaderTimeout: time.Minute,
+	}
+	svr.Serve(mitm.NewConnListener(tlsConn))
+}
+
+// bufferedConn is a hijacked conn that reads through the buffered reader
+// of the http server.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// tunnel relays conn to addr in both directions.
+func tunnel(conn net.Conn, addr string) {
+	defer conn.Close()
+	upstream, err := net.DialTimeout("tcp", addr, 30*time.Second)
+	if err != nil {
+		log.Log.WithError(err).Errorf("unable to dial tunnel target %s", addr)
+		return
+	}
+	defer upstream.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, upstream)
+		done <- struct{}{}
+	}()
+	<-done
+}
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/dynamic"
+	"github.com/jhump/protoreflect/dynamic/grpcdynamic"
+	"github.com/zzong12/hprotoxy/loader"
+	"github.com/zzong12/hprotoxy/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// grpcMetadataPrefix prefixes response headers carrying gRPC header
+	// metadata, grpcTrailerPrefix those carrying trailer metadata.
+	grpcMetadataPrefix = "Grpc-Metadata-"
+	grpcTrailerPrefix  = "Grpc-Trailer-"
+)
+
+// GRPCConfig names a gRPC server that JSON requests to rpc methods, as in
+// "POST /pkg.Service/Method", are sent to as unary gRPC calls. TLS is used
+// unless Plaintext is set.
+type GRPCConfig struct {
+	Target    string
+	Plaintext bool
+	TLS       TLSConfig
+	// Namespace is the schema namespace methods are looked up in.
+	Namespace string
+	// Timeout of a call in seconds, 0 means no timeout.
+	Timeout uint16
+}
+
+type grpcGateway struct {
+	conn      *grpc.ClientConn
+	namespace string
+	timeout   time.Duration
+}
+
+func newGRPCGateway(cfg GRPCConfig) (*grpcGateway, error) {
+	creds := insecure.NewCredentials()
+	if !cfg.Plaintext {
+		tlsCfg, err := cfg.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		creds = credentials.NewTLS(tlsCfg)
+	}
+	conn, err := grpc.Dial(cfg.Target, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	return &grpcGateway{
+		conn:      conn,
+		namespace: cfg.Namespace,
+		timeout:   time.Duration(cfg.Timeout) * time.Second,
+	}, nil
+}
+
+// grpcMethod returns the rpc method r is sent to by the gRPC gateway, or
+// nil if r is proxied as usual: requests for another host (forward proxy
+// requests with an absolute URL), requests with codec headers and requests
+// matching a route are never transcoded to gRPC.
+func (s *Server) grpcMethod(r *http.Request) *desc.MethodDescriptor {
+	if s.grpc == nil || r.URL.IsAbs() || s.matchRoute(r) != nil {
+		return nil
+	}
+	for _, h := range []string{HEADER_REQ_CODEC, HEADER_RES_CODEC, HEADER_CODEC_PROFILE} {
+		if r.Header.Get(h) != "" {
+			return nil
+		}
+	}
+	return s.grpc.method(r)
+}
+
+// method returns the rpc method r calls, or nil if r isn't a JSON request
+// to a known method.
+func (g *grpcGateway) method(r *http.Request) *desc.MethodDescriptor {
+	if r.Method != http.MethodPost || strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		return nil
+	}
+	registry, err := loader.GetLocalLoader().Snapshot().Select(g.namespace)
+	if err != nil {
+		return nil
+	}
+	md, err := registry.GetMethodDescriptor(r.URL.Path)
+	if err != nil {
+		return nil
+	}
+	return md
+}
+
+// serve calls md with the JSON body of r and writes the response as JSON.
+// Header and trailer metadata are returned as Grpc-Metadata-* and
+// Grpc-Trailer-* headers, the gRPC status as Grpc-Status/Grpc-Message and
+// mapped to the HTTP status.
+func (g *grpcGateway) serve(w http.ResponseWriter, r *http.Request, md *desc.MethodDescriptor) {
+	if md.IsClientStreaming() || md.IsServerStreaming() {
+		writeGRPCError(w, status.Errorf(codes.Unimplemented, "streaming method %s is not supported", md.GetFullyQualifiedName()))
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeErrorResponse(w, http.StatusBadRequest, err)
+		return
+	}
+	req := dynamic.NewMessage(md.GetInputType())
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := req.UnmarshalJSONPB(&jsonpb.Unmarshaler{}, body); err != nil {
+			writeGRPCError(w, status.Errorf(codes.InvalidArgument, "invalid %s: %v", md.GetInputType().GetFullyQualifiedName(), err))
+			return
+		}
+	}
+
+	ctx := metadata.NewOutgoingContext(r.Context(), requestMetadata(r.Header))
+	if g.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.timeout)
+		defer cancel()
+	}
+	var header, trailer metadata.MD
+	res, err := grpcdynamic.NewStub(g.conn).InvokeRpc(ctx, md, req, grpc.Header(&header), grpc.Trailer(&trailer))
+	setMetadataHeaders(w.Header(), grpcMetadataPrefix, header)
+	setMetadataHeaders(w.Header(), grpcTrailerPrefix, trailer)
+	if err != nil {
+		log.Log.WithError(err).Error("grpc call failed, method=", md.GetFullyQualifiedName())
+		writeGRPCError(w, err)
+		return
+	}
+
+	resJSON, err := (&jsonpb.Marshaler{EmitDefaults: true}).MarshalToString(res)
+	if err != nil {
+		writeErrorResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Grpc-Status", "0")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, resJSON)
+}
+
+// requestMetadata turns the headers of a request into gRPC metadata,
+// leaving out those describing the HTTP request itself, proxy credentials
+// and the headers of hprotoxy.
+func requestMetadata(h http.Header) metadata.MD {
+	md := metadata.MD{}
+	for k, vs := range h {
+		switch strings.ToLower(k) {
+		case "connection", "content-length", "content-type", "accept-encoding", "te", "host",
+			"keep-alive", "proxy-connection", "transfer-encoding", "upgrade",
+			"proxy-authorization", "proxy-authenticate":
+			continue
+		}
+		switch http.CanonicalHeaderKey(k) {
+		case http.CanonicalHeaderKey(HEADER_REQ_CODEC), http.CanonicalHeaderKey(HEADER_RES_CODEC),
+			http.CanonicalHeaderKey(HEADER_CODEC_PROFILE):
+			continue
+		}
+		md.Append(k, vs...)
+	}
+	return md
+}
+
+func setMetadataHeaders(h http.Header, prefix string, md metadata.MD) {
+	for k, vs := range md {
+		if k == "content-type" {
+			continue
+		}
+		for _, v := range vs {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.StdEncoding.EncodeToString([]byte(v))
+			}
+			h.Add(prefix+k, v)
+		}
+	}
+}
+
+// writeGRPCError writes the gRPC status of err as JSON.
+func writeGRPCError(w http.ResponseWriter, err error) {
+	st := status.Convert(err)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Grpc-Status", strconv.Itoa(int(st.Code())))
+	w.Header().Set("Grpc-Message", st.Message())
+	w.WriteHeader(httpStatusFromCode(st.Code()))
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"code":    st.Code(),
+		"status":  st.Code().String(),
+		"message": st.Message(),
+	})
+}
+
+// httpStatusFromCode maps a gRPC status code to an HTTP status, as
+// https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto
+// documents.
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zzong12/hprotoxy/loader"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// newGRPCTestServer starts a health server with reflection and returns a
+// Server whose gateway calls it, with the schemas loaded by reflection.
+func newGRPCTestServer(t *testing.T) *Server {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := health.NewServer()
+	hs.SetServingStatus("down", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	svr := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(svr, hs)
+	reflection.Register(svr)
+	go svr.Serve(lis)
+	t.Cleanup(svr.Stop)
+
+	target := lis.Addr().String()
+	s, err := NewServer(Config{
+		Sources:    []loader.Root{{Path: t.TempDir()}},
+		Reflection: []ReflectionConfig{{Target: target, Plaintext: true}},
+		GRPC:       GRPCConfig{Target: target, Plaintext: true, Timeout: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.GetLocalLoader().Load(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestGRPCGateway(t *testing.T) {
+	s := newGRPCTestServer(t)
+
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		header     map[string]string
+		status     int
+		grpcStatus string
+		contains   string
+	}{
+		{"ok", "/grpc.health.v1.Health/Check", `{}`, nil, http.StatusOK, "0", `"status":"SERVING"`},
+		{"empty body", "/grpc.health.v1.Health/Check", ``, nil, http.StatusOK, "0", `"status":"SERVING"`},
+		{"not serving", "/grpc.health.v1.Health/Check", `{"service":"down"}`, nil, http.StatusOK, "0", `"status":"NOT_SERVING"`},
+		{"not found", "/grpc.health.v1.Health/Check", `{"service":"nope"}`, nil, http.StatusNotFound, "5", `"status":"NotFound"`},
+		{"invalid json", "/grpc.health.v1.Health/Check", `{"service":1`, nil, http.StatusBadRequest, "3", `"status":"InvalidArgument"`},
+		{"streaming", "/grpc.health.v1.Health/Watch", `{}`, nil, http.StatusNotImplemented, "12", `"status":"Unimplemented"`},
+		// not transcoded, proxied as usual
+		{"unknown method", "/grpc.health.v1.Health/Nope", `{}`, nil, http.StatusBadGateway, "", "no upstream"},
+		{"codec header", "/grpc.health.v1.Health/Check", `{}`, map[string]string{HEADER_REQ_CODEC: "base64:{}"}, 0, "", ""},
+		{"forward proxy", "http://127.0.0.1:1/grpc.health.v1.Health/Check", `{}`, nil, http.StatusBadRequest, "", "request code is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			s.serveProxy(w, r)
+
+			if tt.status != 0 && w.Code != tt.status {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := w.Header().Get("Grpc-Status"); got != tt.grpcStatus {
+				t.Errorf("Grpc-Status = %q, want %q", got, tt.grpcStatus)
+			}
+			if !strings.Contains(w.Body.String(), tt.contains) {
+				t.Errorf("body %s does not contain %s", w.Body, tt.contains)
+			}
+		})
+	}
+}
+
+func TestRequestMetadata(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-Request-Id", "1")
+	h.Set("Authorization", "Bearer x")
+	h.Set("Proxy-Authorization", "Basic x")
+	h.Set("Content-Type", "application/json")
+	h.Set(HEADER_REQ_CODEC, "pb:{}")
+	h.Set(HEADER_RES_CODEC, "pb:{}")
+	h.Set(HEADER_CODEC_PROFILE, "mobile")
+
+	md := requestMetadata(h)
+	for _, k := range []string{"x-request-id", "authorization"} {
+		if len(md.Get(k)) != 1 {
+			t.Errorf("%s not forwarded: %v", k, md)
+		}
+	}
+	for _, k := range []string{"proxy-authorization", "content-type", "reqcodec", "rescodec", "codecprofile"} {
+		if len(md.Get(k)) != 0 {
+			t.Errorf("%s forwarded: %v", k, md)
+		}
+	}
+}
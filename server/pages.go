@@ -22,6 +22,8 @@ const (
 			#meta-table td textarea {height: 20px;width: 400px;}
 			#meta-table header {background-color: #eee;font: bold;}
 			#ctl-box {height: 20px;border: solid;padding: 5px;}
+			#codec-table {border-collapse: collapse;border-style: solid;margin-top: 10px;}
+			#codec-table td {border-style: solid; border-collapse:collapse;padding: 5px;font-size: 14px;}
 		</style>
 	</head>
 	<body>
@@ -29,6 +31,7 @@ const (
 			<form id="ctl-form" action="/do/upload" enctype="multipart/form-data" method="post">
 				Place your file here:
 				<input type="file" multiple="multiple" id="ctl-file" name="pbfile"/>
+				<input type="text" id="ctl-ns" name="ns" placeholder="namespace (optional)"/>
 				<button type="button" id="ctl-upload" onclick="doUpload()">Upload</button>
 				<button type="button" id="ctl-reload" onclick="doReload()">Reload</button>
 			</form>
@@ -45,6 +48,18 @@ const (
 				</header>
 			</table>
 		</div>
+		<div id="codec-box">
+			<table id="codec-table">
+				<header>
+					<tr>
+						<td>Codec</td>
+						<td>Description</td>
+						<td>Params</td>
+						<td>Symmetric</td>
+					</tr>
+				</header>
+			</table>
+		</div>
 	</body>
 	<script>
 		var Ajax = {
@@ -98,16 +113,16 @@ const (
 			
 			})
 		};
-		function doDelete(file) {
-			Ajax.delete('/do/delete?file=' + file, function (data) {
+		function doDelete(file, ns) {
+			Ajax.delete('/do/delete?ns=' + encodeURIComponent(ns) + '&file=' + file, function (data) {
 				if (confirm('Are you sure to delete [' + file + ']?') == true) {
 					alert(data);
 					window.location.reload();
 				}
 			})
 		};
-		function doRead(file) {
-			Ajax.get('/do/read?file=' + file, function (data) {
+		function doRead(file, ns) {
+			Ajax.get('/do/read?ns=' + encodeURIComponent(ns) + '&file=' + file, function (data) {
 				var rs = JSON.parse(data);
 				if (rs["status"] != "ok") {
 					alert(data);
@@ -121,14 +136,26 @@ const (
 			Ajax.get('/st/meta', function (data) {
 				var metaData = JSON.parse(data);
 				var tbl = "<tbody>";
+				var tNamespace = null;
 				var tFileName = "";
 				var tMessageNum = 0;
 				metaData.forEach(function (item) {
+					if (item.namespace !== tNamespace) {
+						if (tFileName != "") {
+							tbl = tbl.replace("{ROWSPAN}", tMessageNum);
+							tMessageNum = 0
+						}
+						tbl += "<tr><td colspan='4'><b>namespace: " + (item.namespace || "default") + "</b></td></tr>";
+						tNamespace = item.namespace;
+						tFileName = "";
+					}
 					tbl += "<tr>";
 					if (item.fileName != tFileName || tFileName == "") {
 						tbl += "<td rowspan='{ROWSPAN}'>" + item.fileName  + "</br>";
-						tbl += "<a onclick='doRead(\"" + item.fileName + "\")'>[read]</a>";
-						tbl += "<a onclick='doDelete(\"" + item.fileName + "\")'>[delete]</a>";
+						if (item.local) {
+							tbl += "<a onclick='doRead(\"" + item.fileName + "\", \"" + item.namespace + "\")'>[read]</a>";
+							tbl += "<a onclick='doDelete(\"" + item.fileName + "\", \"" + item.namespace + "\")'>[delete]</a>";
+						}
 						tbl += "</td>";
 						if (tFileName != "") {
 							tbl = tbl.replace("{ROWSPAN}", tMessageNum);
@@ -146,6 +173,23 @@ const (
 				tbl += "</tbody>";
 				document.getElementById('meta-table').innerHTML += tbl;
 			});
+			Ajax.get('/st/codecs', function (data) {
+				var codecs = JSON.parse(data);
+				var tbl = "<tbody>";
+				codecs.forEach(function (item) {
+					var params = (item.params || []).map(function (p) {
+						return p.name + " (" + p.type + (p.required ? ", required" : "") + ") " + p.desc;
+					}).join("</br>");
+					tbl += "<tr>";
+					tbl += "<td>" + item.name + "</td>";
+					tbl += "<td>" + item.description + "</td>";
+					tbl += "<td>" + params + "</td>";
+					tbl += "<td>" + item.symmetric + "</td>";
+					tbl += "</tr>";
+				})
+				tbl += "</tbody>";
+				document.getElementById('codec-table').innerHTML += tbl;
+			});
 		})();
 	</script>
 	</html>
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Route selects codecs for requests that carry no codec headers. All the
+// non-empty match fields must match; routes are tried in config order and
+// the first match wins.
+type Route struct {
+	// Host matches the request host without port, "*.example.com" matches
+	// any subdomain.
+	Host       string
+	PathPrefix string
+	PathRegex  string
+	Methods    []string
+
+	// Profile names a codec profile, otherwise ReqCodec/ResCodec are used.
+	Profile  string
+	ReqCodec string
+	ResCodec string
+	// ReqMsg/ResMsg add a pb codec with these message types to the front
+	// of the request chain and the end of the response chain.
+	ReqMsg string
+	ResMsg string
+	// Namespace is the schema namespace of ReqMsg/ResMsg.
+	Namespace string
+	// Upstream is the base url matching requests are sent to, overriding
+	// the global Upstream and the url of forward proxy requests.
+	Upstream string
+	// TLS overrides the global upstream TLS options for matching requests.
+	TLS TLSConfig
+
+	pathRegex *regexp.Regexp
+	upstream  *url.URL
+	transport *http.Transport
+}
+
+func (rt *Route) init() error {
+	if rt.PathRegex != "" {
+		re, err := regexp.Compile(rt.PathRegex)
+		if err != nil {
+			return fmt.Errorf("invalid path regex %q: %v", rt.PathRegex, err)
+		}
+		rt.pathRegex = re
+	}
+	var err error
+	if rt.upstream, err = parseUpstream(rt.Upstream); err != nil {
+		return err
+	}
+	if !rt.TLS.isZero() {
+		if rt.transport, err = newTransport(rt.TLS); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func requestHost(r *http.Request) string {
+	host := r.URL.Host
+	if host == "" {
+		host = r.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+func (rt *Route) match(r *http.Request) bool {
+	if rt.Host != "" {
+		host := requestHost(r)
+		pattern := strings.ToLower(rt.Host)
+		if strings.HasPrefix(pattern, "*.") {
+			if !strings.HasSuffix(host, pattern[1:]) {
+				return false
+			}
+		} else if host != pattern {
+			return false
+		}
+	}
+	if rt.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, rt.PathPrefix) {
+		return false
+	}
+	if rt.pathRegex != nil && !rt.pathRegex.MatchString(r.URL.Path) {
+		return false
+	}
+	if len(rt.Methods) > 0 {
+		matched := false
+		for _, m := range rt.Methods {
+			if strings.EqualFold(m, r.Method) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// codecDescs returns the request and response codec descs of the route.
+func (rt *Route) codecDescs(s *Server) (string, string, error) {
+	reqCodec, resCodec := rt.ReqCodec, rt.ResCodec
+	if rt.Profile != "" {
+		p, err := s.profile(rt.Profile)
+		if err != nil {
+			return "", "", err
+		}
+		reqCodec, resCodec = p.ReqCodec, p.ResCodec
+	}
+	if rt.ReqMsg == "" && rt.ResMsg == "" {
+		return reqCodec, resCodec, nil
+	}
+
+	spec, err := json.Marshal(map[string]string{"req": rt.ReqMsg, "res": rt.ResMsg, "ns": rt.Namespace})
+	if err != nil {
+		return "", "", err
+	}
+	pbSpan := "pb:" + string(spec)
+	if reqCodec == "" {
+		reqCodec = pbSpan
+	} else {
+		reqCodec = pbSpan + ";" + reqCodec
+	}
+	if resCodec != "" {
+		resCodec = resCodec + ";" + pbSpan
+	}
+	return reqCodec, resCodec, nil
+}
+
+// matchRoute returns the first route matching r, or nil.
+func (s *Server) matchRoute(r *http.Request) *Route {
+	for i := range s.Routes {
+		if s.Routes[i].match(r) {
+			return &s.Routes[i]
+		}
+	}
+	return nil
+}
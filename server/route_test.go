@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouteMatch(t *testing.T) {
+	tests := []struct {
+		name   string
+		route  Route
+		method string
+		target string
+		host   string
+		want   bool
+	}{
+		{"empty route", Route{}, "GET", "http://a.com/x", "", true},
+		{"host", Route{Host: "api.example.com"}, "GET", "http://api.example.com/x", "", true},
+		{"host with port", Route{Host: "api.example.com"}, "GET", "http://api.example.com:8080/x", "", true},
+		{"host case", Route{Host: "API.Example.com"}, "GET", "http://api.EXAMPLE.com/x", "", true},
+		{"host from header", Route{Host: "api.example.com"}, "GET", "/x", "api.example.com:443", true},
+		{"other host", Route{Host: "api.example.com"}, "GET", "http://example.com/x", "", false},
+		{"wildcard", Route{Host: "*.example.com"}, "GET", "http://a.b.example.com/x", "", true},
+		{"wildcard apex", Route{Host: "*.example.com"}, "GET", "http://example.com/x", "", false},
+		{"wildcard suffix only", Route{Host: "*.example.com"}, "GET", "http://badexample.com/x", "", false},
+		{"path prefix", Route{PathPrefix: "/api/"}, "GET", "http://a.com/api/v1", "", true},
+		{"other path prefix", Route{PathPrefix: "/api/"}, "GET", "http://a.com/apix", "", false},
+		{"path regex", Route{PathRegex: `^/v\d+/users$`}, "GET", "http://a.com/v2/users", "", true},
+		{"other path regex", Route{PathRegex: `^/v\d+/users$`}, "GET", "http://a.com/v2/users/1", "", false},
+		{"regex ignores query", Route{PathRegex: `^/q$`}, "GET", "http://a.com/q?x=/y", "", true},
+		{"method", Route{Methods: []string{"POST", "put"}}, "PUT", "http://a.com/", "", true},
+		{"other method", Route{Methods: []string{"POST"}}, "GET", "http://a.com/", "", false},
+		{"all fields", Route{Host: "a.com", PathPrefix: "/api", PathRegex: `/1$`, Methods: []string{"POST"}}, "POST", "http://a.com/api/1", "", true},
+		{"all fields but one", Route{Host: "a.com", PathPrefix: "/api", PathRegex: `/1$`, Methods: []string{"POST"}}, "POST", "http://a.com/api/2", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.route.init(); err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			if got := tt.route.match(r); got != tt.want {
+				t.Errorf("match(%s %s) = %v, want %v", tt.method, tt.target, got, tt.want)
+			}
+		})
+	}
+
+	if err := (&Route{PathRegex: "("}).init(); err == nil {
+		t.Errorf("init with an invalid regex succeeded")
+	}
+}
+
+func TestRouteCodecDescs(t *testing.T) {
+	s := &Server{Profiles: map[string]Profile{
+		"mobile": {ReqCodec: "base64:{}", ResCodec: "gzip:{}"},
+	}}
+	tests := []struct {
+		name    string
+		route   Route
+		wantReq string
+		wantRes string
+		wantErr bool
+	}{
+		{"codecs", Route{ReqCodec: "base64:{}", ResCodec: "gzip:{}"}, "base64:{}", "gzip:{}", false},
+		{"profile", Route{Profile: "mobile", ReqCodec: "url:{}"}, "base64:{}", "gzip:{}", false},
+		{"unknown profile", Route{Profile: "nope"}, "", "", true},
+		{"messages only", Route{ReqMsg: "a.Req", ResMsg: "a.Res"},
+			`pb:{"ns":"","req":"a.Req","res":"a.Res"}`, "", false},
+		{"messages and codecs", Route{ReqCodec: "base64:{}", ResCodec: "gzip:{}", ReqMsg: "a.Req", ResMsg: "a.Res", Namespace: "ns1"},
+			`pb:{"ns":"ns1","req":"a.Req","res":"a.Res"};base64:{}`, `gzip:{};pb:{"ns":"ns1","req":"a.Req","res":"a.Res"}`, false},
+		{"messages and request codec", Route{ReqCodec: "base64:{}", ResMsg: "a.Res"},
+			`pb:{"ns":"","req":"","res":"a.Res"};base64:{}`, "", false},
+		{"messages and profile", Route{Profile: "mobile", ReqMsg: "a.Req"},
+			`pb:{"ns":"","req":"a.Req","res":""};base64:{}`, `gzip:{};pb:{"ns":"","req":"a.Req","res":""}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, res, err := tt.route.codecDescs(s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("codecDescs error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if req != tt.wantReq || res != tt.wantRes {
+				t.Errorf("codecDescs = %q, %q, want %q, %q", req, res, tt.wantReq, tt.wantRes)
+			}
+		})
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	s := &Server{Routes: []Route{
+		{PathPrefix: "/api/v1", ReqCodec: "first"},
+		{PathPrefix: "/api", ReqCodec: "second"},
+	}}
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"http://a.com/api/v1/x", "first"},
+		{"http://a.com/api/v2", "second"},
+		{"http://a.com/other", ""},
+	}
+	for _, tt := range tests {
+		var got string
+		if rt := s.matchRoute(httptest.NewRequest("GET", tt.target, nil)); rt != nil {
+			got = rt.ReqCodec
+		}
+		if got != tt.want {
+			t.Errorf("matchRoute(%s) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
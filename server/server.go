@@ -3,12 +3,16 @@ package server
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
 	"os"
 	"os/signal"
+	"path"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,53 +20,287 @@ import (
 	"github.com/zzong12/hprotoxy/codec"
 	"github.com/zzong12/hprotoxy/loader"
 	"github.com/zzong12/hprotoxy/log"
+	"github.com/zzong12/hprotoxy/mitm"
 
 	"github.com/golang/protobuf/jsonpb"
+	"github.com/jhump/protoreflect/desc"
 	"github.com/jhump/protoreflect/dynamic"
 )
 
 const (
-	HEADER_REQ_CODEC = "ReqCodec"
-	HEADER_RES_CODEC = "ResCodec"
+	HEADER_REQ_CODEC         = "ReqCodec"
+	HEADER_RES_CODEC         = "ResCodec"
+	HEADER_CODEC_PROFILE     = "CodecProfile"
+	HEADER_SCHEMA_GENERATION = "X-Hprotoxy-Schema-Generation"
+
+	// profilePrefix marks a codec header value as a reference to a named
+	// profile, e.g. "ReqCodec: @mobile".
+	profilePrefix = "@"
 )
 
 type (
 	Config struct {
-		ImportPath     string
-		LoadFolder     string
+		ImportPath string
+		// ImportPaths are searched for imports after ImportPath.
+		ImportPaths []string
+		LoadFolder  string
+		// Sources are the folders schema files are loaded from, by default
+		// LoadFolder inside ImportPath.
+		Sources        []loader.Root
 		ReloadInterval uint16
+		WatchFiles     bool
 		ProxyPort      uint16
 		ManagerPort    uint16
+		Profiles       map[string]Profile
+		Routes         []Route
+
+		// Upstream is the base url requests without an absolute url are
+		// sent to, turning the proxy port into a reverse proxy.
+		Upstream string
+		// TLS configures TLS towards upstream servers, routes may
+		// override it.
+		TLS  TLSConfig
+		MITM MITMConfig
+		// Reflection lists gRPC servers whose schemas are loaded through
+		// server reflection, next to the local files.
+		Reflection []ReflectionConfig
+		// GRPC turns JSON requests to rpc methods into gRPC calls.
+		GRPC GRPCConfig
+	}
+
+	// ReflectionConfig is a gRPC server with reflection enabled. TLS is used
+	// unless Plaintext is set.
+	ReflectionConfig struct {
+		Target    string
+		Plaintext bool
+		TLS       TLSConfig
+		Namespace string
+	}
+
+	// MITMConfig names the CA used to intercept CONNECT tunnels, see the
+	// "ca" command to create one. CONNECT tunnels are relayed untouched
+	// when it is not set.
+	MITMConfig struct {
+		CACert string
+		CAKey  string
+	}
+
+	// Profile is a named pair of codec chains defined in the config file.
+	// An empty ResCodec means the inverted ReqCodec.
+	Profile struct {
+		ReqCodec string
+		ResCodec string
 	}
 
 	Server struct {
 		ProxyPort   uint16
 		ManagerPort uint16
+		Profiles    map[string]Profile
+		Routes      []Route
+
+		upstream  *url.URL
+		transport *http.Transport
+		ca        *mitm.CA
+		grpc      *grpcGateway
 	}
 
 	MetaItem struct {
-		FileName string `json:"fileName"`
-		MsgName  string `json:"msgName"`
-		MsgType  string `json:"msgType"`
-		Example  string `json:"example"`
+		Namespace string `json:"namespace"`
+		FileName  string `json:"fileName"`
+		MsgName   string `json:"msgName"`
+		MsgType   string `json:"msgType"`
+		Example   string `json:"example"`
+		// Local is set for the types of files on disk, which can be read
+		// and deleted.
+		Local bool `json:"local"`
 	}
 )
 
-func NewServer(cfg Config) *Server {
-	loader.InitLoader(cfg.ImportPath, cfg.LoadFolder, cfg.ReloadInterval)
+// ReflectionSources returns the loader sources of cfg.Reflection.
+func (cfg Config) ReflectionSources() ([]loader.ReflectionSource, error) {
+	var sources []loader.ReflectionSource
+	for _, rc := range cfg.Reflection {
+		src := loader.ReflectionSource{Target: rc.Target, Namespace: rc.Namespace}
+		if !rc.Plaintext {
+			tlsCfg, err := rc.TLS.build()
+			if err != nil {
+				return nil, fmt.Errorf("reflection %s tls: %v", rc.Target, err)
+			}
+			src.TLS = tlsCfg
+		}
+		sources = append(sources, src)
+	}
+	return sources, nil
+}
+
+func NewServer(cfg Config) (*Server, error) {
+	loader.InitLoader(cfg.LoaderOptions())
+	sources, err := cfg.ReflectionSources()
+	if err != nil {
+		return nil, err
+	}
+	for _, src := range sources {
+		loader.GetLocalLoader().AddReflectionSource(src)
+	}
+	for name, p := range cfg.Profiles {
+		if _, err := codec.ParserCodes(p.ReqCodec); err != nil {
+			return nil, fmt.Errorf("profile %s: invalid request codec: %v", name, err)
+		}
+		if p.ResCodec == "" {
+			continue
+		}
+		if _, err := codec.ParserCodes(p.ResCodec); err != nil {
+			return nil, fmt.Errorf("profile %s: invalid response codec: %v", name, err)
+		}
+	}
+	for i := range cfg.Routes {
+		if err := cfg.Routes[i].init(); err != nil {
+			return nil, fmt.Errorf("route %d: %v", i, err)
+		}
+	}
+	upstream, err := parseUpstream(cfg.Upstream)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := newTransport(cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("upstream tls: %v", err)
+	}
+	var ca *mitm.CA
+	if cfg.MITM.CACert != "" || cfg.MITM.CAKey != "" {
+		if ca, err = mitm.LoadCA(cfg.MITM.CACert, cfg.MITM.CAKey); err != nil {
+			return nil, fmt.Errorf("load mitm ca: %v", err)
+		}
+	}
+	var gw *grpcGateway
+	if cfg.GRPC.Target != "" {
+		if gw, err = newGRPCGateway(cfg.GRPC); err != nil {
+			return nil, fmt.Errorf("grpc %s: %v", cfg.GRPC.Target, err)
+		}
+	}
 	return &Server{
 		ProxyPort:   cfg.ProxyPort,
 		ManagerPort: cfg.ManagerPort,
+		Profiles:    cfg.Profiles,
+		Routes:      cfg.Routes,
+		upstream:    upstream,
+		transport:   transport,
+		ca:          ca,
+		grpc:        gw,
+	}, nil
+}
+
+// LoaderOptions returns the options of the proto loader.
+func (cfg Config) LoaderOptions() loader.Options {
+	importPath := cfg.ImportPath
+	if importPath == "" {
+		importPath = "."
 	}
+	opts := loader.Options{
+		ImportPaths:    append([]string{importPath}, cfg.ImportPaths...),
+		Roots:          cfg.Sources,
+		ReloadInterval: cfg.ReloadInterval,
+		Watch:          cfg.WatchFiles,
+	}
+	if len(opts.Roots) == 0 {
+		opts.Roots = []loader.Root{{Path: path.Join(importPath, cfg.LoadFolder)}}
+	}
+	return opts
 }
 
+var errHijackUnsupported = errors.New("connection does not support hijacking")
+
 func writeErrorResponse(w http.ResponseWriter, status int, err error) {
 	w.WriteHeader(status)
 	w.Header().Set("Content-Type", "text/plain")
 	w.Write([]byte("HProtoxy was unable to successfully proxy the request. See logs for details.\nerror: " + err.Error()))
 }
 
+// streamThreshold is the body size up to which bodies of a known length
+// are buffered even if their codecs can stream, so they keep a
+// Content-Length.
+const streamThreshold = 1 << 20
+
+// streamPrefetchSize is the most read of a stream before it is started.
+const streamPrefetchSize = 32 << 10
+
+// shouldStream reports whether a body of size bytes, -1 if unknown, is
+// worth streaming.
+func shouldStream(size int64) bool {
+	return size < 0 || size > streamThreshold
+}
+
+// streamBody is the body of a request or response streamed through a codec
+// chain. Close closes the original body.
+type streamBody struct {
+	io.Reader
+	body io.Closer
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	if err != nil && err != io.EOF {
+		log.Log.WithError(err).Error("error streaming body through codecs")
+	}
+	return n, err
+}
+
+func (b *streamBody) Close() error {
+	return b.body.Close()
+}
+
+// startStream reads the first chunk of rd, the body coded by a chain, so
+// that errors at the start of the data are returned while an error response
+// can still be sent. It returns the new body and its length, -1 if it is
+// streamed; a body that ends within the first chunk isn't.
+func startStream(rd io.Reader, body io.ReadCloser) (io.ReadCloser, int64, error) {
+	buf := make([]byte, streamPrefetchSize)
+	var n int
+	var err error
+	for n == 0 && err == nil {
+		n, err = rd.Read(buf)
+	}
+	if err == io.EOF {
+		body.Close()
+		return ioutil.NopCloser(bytes.NewReader(buf[:n])), int64(n), nil
+	}
+	if err != nil {
+		body.Close()
+		return nil, 0, err
+	}
+	return &streamBody{Reader: io.MultiReader(bytes.NewReader(buf[:n]), rd), body: body}, -1, nil
+}
+
+// setStreamLength sets the length of a body returned by startStream.
+func setStreamLength(h http.Header, contentLength *int64, n int64) {
+	*contentLength = n
+	if n < 0 {
+		h.Del("Content-Length")
+	} else {
+		h.Set("Content-Length", strconv.FormatInt(n, 10))
+	}
+}
+
+// replaceReqBody encodes the body of r with cs. Large bodies and bodies of
+// unknown length are streamed if every codec of cs can stream.
 func replaceReqBody(r *http.Request, cs codec.Codecs) error {
+	if r.Body != nil && r.Body != http.NoBody && shouldStream(r.ContentLength) {
+		if rd, err := cs.EncodeStream(r.Body); err == nil {
+			body, n, err := startStream(rd, r.Body)
+			if err != nil {
+				return err
+			}
+			r.Body = body
+			setStreamLength(r.Header, &r.ContentLength, n)
+			if n >= 0 {
+				r.TransferEncoding = nil
+			}
+			return nil
+		} else if err != codec.ErrNotStreamable {
+			return err
+		}
+	}
+
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		return err
@@ -80,22 +318,96 @@ func replaceReqBody(r *http.Request, cs codec.Codecs) error {
 	return nil
 }
 
-func (s *Server) paresrCodecs(r *http.Request) (codec.Codecs, codec.Codecs, error) {
-	reqCodec := r.Header.Get(HEADER_REQ_CODEC)
-	if reqCodec == "" {
+func (s *Server) profile(name string) (Profile, error) {
+	p, ok := s.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("codec profile not found: %s", name)
+	}
+	return p, nil
+}
+
+// invertDesc reverses the order of the codecs in desc.
+func invertDesc(desc string) string {
+	spans := strings.Split(desc, ";")
+	for i, j := 0, len(spans)-1; i < j; i, j = i+1, j-1 {
+		spans[i], spans[j] = spans[j], spans[i]
+	}
+	return strings.Join(spans, ";")
+}
+
+// chainDesc is a codec chain desc and whether it comes from the config
+// file, so its keys may be read from the environment or files.
+type chainDesc struct {
+	desc   string
+	config bool
+}
+
+func (c chainDesc) parse() (codec.Codecs, error) {
+	if c.config {
+		return codec.ParserCodes(c.desc)
+	}
+	return codec.ParserClientCodes(c.desc)
+}
+
+// codecDescs returns the request and response codec descs of r, resolving
+// references to named profiles. Codec headers take precedence over the
+// matched route, if any. An empty response desc means the inverted request
+// codecs.
+func (s *Server) codecDescs(r *http.Request, route *Route) (chainDesc, chainDesc, error) {
+	reqCodec := chainDesc{desc: r.Header.Get(HEADER_REQ_CODEC)}
+	resCodec := chainDesc{desc: r.Header.Get(HEADER_RES_CODEC)}
+	if route != nil && reqCodec.desc == "" && resCodec.desc == "" && r.Header.Get(HEADER_CODEC_PROFILE) == "" {
+		req, res, err := route.codecDescs(s)
+		return chainDesc{req, true}, chainDesc{res, true}, err
+	}
+
+	profileName := r.Header.Get(HEADER_CODEC_PROFILE)
+	if strings.HasPrefix(reqCodec.desc, profilePrefix) {
+		profileName = reqCodec.desc[len(profilePrefix):]
+	} else if reqCodec.desc != "" {
+		profileName = ""
+	}
+	if profileName != "" {
+		p, err := s.profile(profileName)
+		if err != nil {
+			return chainDesc{}, chainDesc{}, err
+		}
+		reqCodec = chainDesc{p.ReqCodec, true}
+		if resCodec.desc == "" {
+			resCodec = chainDesc{p.ResCodec, true}
+		}
+	}
+	if strings.HasPrefix(resCodec.desc, profilePrefix) {
+		p, err := s.profile(resCodec.desc[len(profilePrefix):])
+		if err != nil {
+			return chainDesc{}, chainDesc{}, err
+		}
+		resCodec = chainDesc{p.ResCodec, true}
+		if resCodec.desc == "" {
+			resCodec.desc = invertDesc(p.ReqCodec)
+		}
+	}
+	return reqCodec, resCodec, nil
+}
+
+func (s *Server) paresrCodecs(r *http.Request, route *Route) (codec.Codecs, codec.Codecs, error) {
+	reqCodec, resCode, err := s.codecDescs(r, route)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reqCodec.desc == "" {
 		return nil, nil, fmt.Errorf("request code is empty")
 	}
 
-	reqCodecs, err := codec.ParserCodes(reqCodec)
+	reqCodecs, err := reqCodec.parse()
 	if err != nil {
 		return nil, nil, fmt.Errorf("request code is invalid: %v", err)
 	}
 	var resCodecs codec.Codecs
-	resCode := r.Header.Get(HEADER_RES_CODEC)
-	if resCode == "" { // default use request code as response code
+	if resCode.desc == "" { // default use request code as response code
 		resCodecs = reqCodecs.Inverted()
 	} else {
-		resCodecs, err = codec.ParserCodes(resCode)
+		resCodecs, err = resCode.parse()
 		if err != nil {
 			return nil, nil, fmt.Errorf("response code is invalid: %v", err)
 		}
@@ -105,7 +417,14 @@ func (s *Server) paresrCodecs(r *http.Request) (codec.Codecs, codec.Codecs, erro
 }
 
 func (s *Server) proxyRequest(w http.ResponseWriter, r *http.Request) {
-	reqCodes, resCodes, err := s.paresrCodecs(r)
+	route := s.matchRoute(r)
+	upstream, err := s.upstreamFor(r, route)
+	if err != nil {
+		log.Log.WithError(err).Error("unable to find upstream")
+		writeErrorResponse(w, http.StatusBadGateway, err)
+		return
+	}
+	reqCodes, resCodes, err := s.paresrCodecs(r, route)
 	if err != nil {
 		log.Log.WithError(err).Error("unable to parse codes")
 		writeErrorResponse(w, http.StatusBadRequest, err)
@@ -123,6 +442,23 @@ func (s *Server) proxyRequest(w http.ResponseWriter, r *http.Request) {
 	// r.Header.Set("Content-Type", "application/x-protobuf")
 
 	modifyResponse := func(r *http.Response) error {
+		r.Header.Set(HEADER_SCHEMA_GENERATION, strconv.FormatUint(loader.GetLocalLoader().Snapshot().Generation, 10))
+		// chunked responses, like server streams, and large ones are streamed
+		if shouldStream(r.ContentLength) {
+			if rd, err := resCodes.DecodeStream(r.Body); err == nil {
+				body, n, err := startStream(rd, r.Body)
+				if err != nil {
+					return fmt.Errorf("Failed to decode response: %v", err)
+				}
+				r.Body = body
+				setStreamLength(r.Header, &r.ContentLength, n)
+				r.Header.Set("Content-Type", "application/json")
+				return nil
+			} else if err != codec.ErrNotStreamable {
+				return fmt.Errorf("Failed to decode response: %v", err)
+			}
+		}
+
 		body, err := ioutil.ReadAll(r.Body)
 		if err != nil {
 			return fmt.Errorf("Failed to read response body: %v", err)
@@ -150,8 +486,14 @@ func (s *Server) proxyRequest(w http.ResponseWriter, r *http.Request) {
 		writeErrorResponse(w, http.StatusBadRequest, err)
 	}
 
+	director := func(*http.Request) {}
+	if upstream != nil {
+		director = func(r *http.Request) { rewriteUpstream(r, upstream) }
+	}
+
 	proxy := &httputil.ReverseProxy{
-		Director:       func(*http.Request) {},
+		Director:       director,
+		Transport:      s.transportFor(route),
 		ModifyResponse: modifyResponse,
 		ErrorHandler:   errorHandler,
 	}
@@ -161,79 +503,179 @@ func (s *Server) proxyRequest(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) apiMeta(w http.ResponseWriter, r *http.Request) {
 	var res []*MetaItem
-	for _, fd := range loader.GetLocalLoader().ListFileDescriptor() {
-		for _, v := range fd.GetMessageTypes() {
+	registry := loader.GetLocalLoader().Snapshot()
+	for _, ns := range registry.Namespaces() {
+		nsRegistry, _ := registry.Select(ns)
+		res = append(res, metaItems(nsRegistry)...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(HEADER_SCHEMA_GENERATION, strconv.FormatUint(registry.Generation, 10))
+	json.NewEncoder(w).Encode(res)
+}
+
+// metaItems lists the types of a namespace registry.
+func metaItems(registry *loader.Registry) []*MetaItem {
+	var res []*MetaItem
+	for _, fd := range registry.ListFileDescriptor() {
+		fileName, local := registry.Source(fd), registry.IsLocal(fd)
+		for _, v := range loader.FileMessages(fd) {
 			zeroV, _ := dynamic.NewMessage(v).MarshalJSONPB(&jsonpb.Marshaler{
 				OrigName:     true,
 				EnumsAsInts:  true,
 				EmitDefaults: true,
 			})
 			res = append(res, &MetaItem{
-				FileName: fd.GetName(),
+				FileName: fileName,
+				Local:    local,
 				MsgName:  v.GetFullyQualifiedName(),
 				MsgType:  "message",
 				Example:  string(zeroV),
 			})
 		}
-		for _, v := range fd.GetEnumTypes() {
+		for _, v := range loader.FileEnums(fd) {
 			res = append(res, &MetaItem{
-				FileName: fd.GetName(),
+				FileName: fileName,
+				Local:    local,
 				MsgName:  v.GetFullyQualifiedName(),
 				MsgType:  "enum",
 				Example:  v.String(),
 			})
 		}
+		for _, v := range fd.GetServices() {
+			var methods []string
+			for _, m := range v.GetMethods() {
+				methods = append(methods, m.GetName())
+			}
+			res = append(res, &MetaItem{
+				FileName: fileName,
+				Local:    local,
+				MsgName:  v.GetFullyQualifiedName(),
+				MsgType:  "service",
+				Example:  strings.Join(methods, ", "),
+			})
+			for _, m := range v.GetMethods() {
+				res = append(res, &MetaItem{
+					FileName: fileName,
+					Local:    local,
+					MsgName:  v.GetFullyQualifiedName() + "/" + m.GetName(),
+					MsgType:  "method",
+					Example:  methodSignature(m),
+				})
+			}
+		}
+	}
+	for _, item := range res {
+		item.Namespace = registry.Namespace
+	}
+	return res
+}
+
+// methodSignature renders m like its rpc declaration.
+func methodSignature(m *desc.MethodDescriptor) string {
+	in, out := m.GetInputType().GetFullyQualifiedName(), m.GetOutputType().GetFullyQualifiedName()
+	if m.IsClientStreaming() {
+		in = "stream " + in
+	}
+	if m.IsServerStreaming() {
+		out = "stream " + out
+	}
+	return fmt.Sprintf("rpc %s(%s) returns (%s)", m.GetName(), in, out)
+}
+
+func (s *Server) apiCodecs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(codec.List())
+}
+
+func (s *Server) apiCACert(w http.ResponseWriter, r *http.Request) {
+	if s.ca == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
 	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Header().Set("Content-Disposition", "attachment; filename=hprotoxy-ca.crt")
+	w.Write(s.ca.CertPEM())
+}
 
+func (s *Server) apiVersion(w http.ResponseWriter, r *http.Request) {
+	registry := loader.GetLocalLoader().Snapshot()
+	res := map[string]interface{}{
+		"generation": registry.Generation,
+		"loadTime":   registry.LoadTime,
+		"files":      len(registry.ListFileDescriptor()),
+		"namespaces": registry.Namespaces(),
+		"lastReload": loader.GetLocalLoader().LastReload(),
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(res)
 }
 
 func (s *Server) apiReload(w http.ResponseWriter, r *http.Request) {
-	res := make(map[string]string)
+	res := make(map[string]interface{})
 	if err := loader.GetLocalLoader().Load(); err != nil {
 		res["status"] = "error"
 		res["error"] = err.Error()
 	} else {
 		res["status"] = "ok"
 	}
+	if diags := loader.GetLocalLoader().LastReload().Diagnostics; len(diags) > 0 {
+		res["diagnostics"] = diags
+	}
+	res["generation"] = loader.GetLocalLoader().Snapshot().Generation
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(res)
 }
 
+// apiUpload stores the uploaded schema files in the namespace of the "ns"
+// form field. Files that don't compile are rejected as a whole, with the
+// diagnostics in the response.
 func (s *Server) apiUpload(w http.ResponseWriter, r *http.Request) {
-	res := make(map[string]string)
+	res := make(map[string]interface{})
+	var errMsg string
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		res["status"] = "error"
-		res["error"] = err.Error()
+		errMsg = err.Error()
 	} else {
+		files := make(map[string][]byte)
 		for _, fheaders := range r.MultipartForm.File {
 			for _, hdr := range fheaders {
-				if !strings.HasSuffix(hdr.Filename, ".proto") {
-					res["status"] = "error"
-					if res["error"] == "" {
-						res["error"] = "only .proto files are allowed, bug got "
+				if !loader.IsSchemaFile(hdr.Filename) {
+					if errMsg == "" {
+						errMsg = "only .proto, .protoset and .pb files are allowed, bug got "
 					}
-					res["error"] += fmt.Sprintf(" %s", hdr.Filename)
+					errMsg += fmt.Sprintf(" %s", hdr.Filename)
 					continue
 				}
 				file, err := hdr.Open()
-				if err != nil {
-					res["status"] = "error"
-					res["error"] = err.Error()
-					break
+				if err == nil {
+					files[hdr.Filename], err = io.ReadAll(file)
+					file.Close()
 				}
-				if err := loader.GetLocalLoader().AddFile(hdr.Filename, file); err != nil {
-					res["status"] = "error"
-					res["error"] = err.Error()
+				if err != nil {
+					errMsg = err.Error()
 					break
 				}
 			}
 		}
-		if _, ok := res["status"]; !ok {
-			res["status"] = "ok"
+		if len(files) > 0 && errMsg == "" {
+			err := loader.GetLocalLoader().AddFiles(r.FormValue("ns"), files)
+			var diagErr *loader.DiagnosticsError
+			if errors.As(err, &diagErr) {
+				res["diagnostics"] = diagErr.Diagnostics
+			} else if diags := loader.GetLocalLoader().LastReload().Diagnostics; len(diags) > 0 {
+				res["diagnostics"] = diags
+			}
+			if err != nil {
+				errMsg = err.Error()
+			}
 		}
 	}
+	if errMsg != "" {
+		res["status"] = "error"
+		res["error"] = errMsg
+	} else {
+		res["status"] = "ok"
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(res)
 }
@@ -246,7 +688,7 @@ func (s *Server) apiDelete(w http.ResponseWriter, r *http.Request) {
 		res["error"] = "only DELETE method is allowed"
 	} else {
 		fileName := r.URL.Query().Get("file")
-		err := loader.GetLocalLoader().DelFile(fileName)
+		err := loader.GetLocalLoader().DelFile(r.URL.Query().Get("ns"), fileName)
 		if err != nil {
 			res["status"] = "error"
 			res["error"] = err.Error()
@@ -265,7 +707,7 @@ func (s *Server) apiRead(w http.ResponseWriter, r *http.Request) {
 		res["error"] = "only GET method is allowed"
 	} else {
 		fileName := r.URL.Query().Get("file")
-		file, err := loader.GetLocalLoader().ReadFile(fileName)
+		file, err := loader.GetLocalLoader().ReadFile(r.URL.Query().Get("ns"), fileName)
 		if err != nil {
 			res["status"] = "error"
 			res["error"] = err.Error()
@@ -304,11 +746,9 @@ func (s *Server) Run() {
 
 	// proxy server
 	go func() {
-		proxySvrMux := http.NewServeMux()
-		proxySvrMux.HandleFunc("/", s.proxyRequest)
 		proxySvr := http.Server{
 			Addr:    fmt.Sprintf(":%d", s.ProxyPort),
-			Handler: proxySvrMux,
+			Handler: http.HandlerFunc(s.serveProxy),
 		}
 		log.Log.Infof("Proxy server started on port %d", s.ProxyPort)
 		wg.Done()
@@ -319,10 +759,15 @@ func (s *Server) Run() {
 	go func() {
 		managerSvrMux := http.NewServeMux()
 		managerSvrMux.HandleFunc("/st/meta", s.apiMeta)
+		managerSvrMux.HandleFunc("/st/codecs", s.apiCodecs)
+		managerSvrMux.HandleFunc("/st/version", s.apiVersion)
+		managerSvrMux.HandleFunc("/st/ca.crt", s.apiCACert)
 		managerSvrMux.HandleFunc("/do/reload", s.apiReload)
 		managerSvrMux.HandleFunc("/do/upload", s.apiUpload)
 		managerSvrMux.HandleFunc("/do/delete", s.apiDelete)
 		managerSvrMux.HandleFunc("/do/read", s.apiRead)
+		managerSvrMux.HandleFunc("/do/encode", s.apiEncode)
+		managerSvrMux.HandleFunc("/do/decode", s.apiDecode)
 		managerSvrMux.HandleFunc("/", s.webPages)
 		managerSvr := http.Server{
 			Addr:    fmt.Sprintf(":%d", s.ManagerPort),
@@ -336,7 +781,7 @@ func (s *Server) Run() {
 	wg.Wait()
 	// wait for interrupt signal to gracefully shutdown the server with
 	log.Log.Info("Press Ctrl+C to stop the server")
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, os.Kill)
 	<-quit
 	log.Log.Info("Shutting down server...")
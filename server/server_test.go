@@ -0,0 +1,150 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/zzong12/hprotoxy/loader"
+)
+
+func TestClientChainKeys(t *testing.T) {
+	t.Setenv("HPROTOXY_TEST_KEY", "secret")
+	s, err := NewServer(Config{
+		Sources:  []loader.Root{{Path: t.TempDir()}},
+		Profiles: map[string]Profile{"env": {ReqCodec: `rc4:{"key":"env:HPROTOXY_TEST_KEY"}`}},
+		Routes:   []Route{{PathPrefix: "/route", ReqCodec: `rc4:{"key":"env:HPROTOXY_TEST_KEY"}`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		path    string
+		header  map[string]string
+		wantErr string
+	}{
+		{"profile", "/", map[string]string{HEADER_CODEC_PROFILE: "env"}, ""},
+		{"profile reference", "/", map[string]string{HEADER_REQ_CODEC: "@env"}, ""},
+		{"route", "/route", nil, ""},
+		{"request header", "/", map[string]string{HEADER_REQ_CODEC: `rc4:{"key":"env:HPROTOXY_TEST_KEY"}`}, "request code is invalid"},
+		{"response header", "/", map[string]string{HEADER_CODEC_PROFILE: "env", HEADER_RES_CODEC: `rc4:{"key":"file:/etc/hostname"}`}, "response code is invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			_, _, err := s.paresrCodecs(r, s.matchRoute(r))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("paresrCodecs: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("paresrCodecs error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	for _, chain := range []string{`rc4:{"key":"env:HPROTOXY_TEST_KEY"}`, "@env"} {
+		body := `{"chain":` + strconv.Quote(chain) + `,"body":"hi"}`
+		res := s.transcode(httptest.NewRequest(http.MethodPost, "/do/encode", strings.NewReader(body)), true)
+		if wantOK := chain == "@env"; (res.Status == "ok") != wantOK {
+			t.Errorf("transcode with chain %s = %s %s", chain, res.Status, res.Error)
+		}
+	}
+}
+
+func TestCodecDescs(t *testing.T) {
+	s := &Server{
+		Profiles: map[string]Profile{
+			"mobile": {ReqCodec: "aes:{};base64:{}", ResCodec: "base64:{};rc4:{}"},
+			"plain":  {ReqCodec: "gzip:{};base64:{}"},
+		},
+	}
+	route := &Route{ReqCodec: "url:{}"}
+
+	tests := []struct {
+		name    string
+		header  map[string]string
+		route   *Route
+		wantReq string
+		wantRes string
+		wantErr bool
+	}{
+		{"headers", map[string]string{HEADER_REQ_CODEC: "base64:{}", HEADER_RES_CODEC: "gzip:{}"}, nil, "base64:{}", "gzip:{}", false},
+		{"request header only", map[string]string{HEADER_REQ_CODEC: "base64:{}"}, nil, "base64:{}", "", false},
+		{"none", nil, nil, "", "", false},
+		{"route", nil, route, "url:{}", "", false},
+		{"header over route", map[string]string{HEADER_REQ_CODEC: "base64:{}"}, route, "base64:{}", "", false},
+		{"@profile", map[string]string{HEADER_REQ_CODEC: "@mobile"}, nil, "aes:{};base64:{}", "base64:{};rc4:{}", false},
+		{"@profile with response header", map[string]string{HEADER_REQ_CODEC: "@mobile", HEADER_RES_CODEC: "gzip:{}"}, nil, "aes:{};base64:{}", "gzip:{}", false},
+		{"@profile without response", map[string]string{HEADER_REQ_CODEC: "@plain"}, nil, "gzip:{};base64:{}", "", false},
+		{"profile header", map[string]string{HEADER_CODEC_PROFILE: "mobile"}, route, "aes:{};base64:{}", "base64:{};rc4:{}", false},
+		{"request header over profile header", map[string]string{HEADER_CODEC_PROFILE: "mobile", HEADER_REQ_CODEC: "url:{}"}, nil, "url:{}", "", false},
+		{"@ over profile header", map[string]string{HEADER_CODEC_PROFILE: "mobile", HEADER_REQ_CODEC: "@plain"}, nil, "gzip:{};base64:{}", "", false},
+		{"@ response", map[string]string{HEADER_REQ_CODEC: "url:{}", HEADER_RES_CODEC: "@mobile"}, nil, "url:{}", "base64:{};rc4:{}", false},
+		{"@ response without response codec", map[string]string{HEADER_REQ_CODEC: "url:{}", HEADER_RES_CODEC: "@plain"}, nil, "url:{}", "base64:{};gzip:{}", false},
+		{"unknown @profile", map[string]string{HEADER_REQ_CODEC: "@nope"}, nil, "", "", true},
+		{"unknown profile header", map[string]string{HEADER_CODEC_PROFILE: "nope"}, nil, "", "", true},
+		{"unknown @ response", map[string]string{HEADER_REQ_CODEC: "url:{}", HEADER_RES_CODEC: "@nope"}, nil, "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			req, res, err := s.codecDescs(r, tt.route)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("codecDescs error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if req.desc != tt.wantReq || res.desc != tt.wantRes {
+				t.Errorf("codecDescs = %q, %q, want %q, %q", req.desc, res.desc, tt.wantReq, tt.wantRes)
+			}
+		})
+	}
+}
+
+func TestInvalidProfile(t *testing.T) {
+	for _, p := range []Profile{
+		{ReqCodec: "nope:{}"},
+		{ReqCodec: "base64:{}", ResCodec: "aes:{"},
+	} {
+		_, err := NewServer(Config{
+			Sources:  []loader.Root{{Path: t.TempDir()}},
+			Profiles: map[string]Profile{"bad": p},
+		})
+		if err == nil || !strings.Contains(err.Error(), "profile bad") {
+			t.Errorf("NewServer with profile %+v: error = %v", p, err)
+		}
+	}
+}
+
+func TestMetaItemsLocal(t *testing.T) {
+	dir := t.TempDir()
+	proto := `syntax = "proto3"; package a; import "google/protobuf/timestamp.proto"; message A { google.protobuf.Timestamp at = 1; }`
+	if err := os.WriteFile(filepath.Join(dir, "a.proto"), []byte(proto), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewServer(Config{ImportPath: dir, Sources: []loader.Root{{Path: dir}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := loader.GetLocalLoader().Load(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]bool{"a.A": true, "google.protobuf.Timestamp": false}
+	for _, item := range metaItems(loader.GetLocalLoader().Snapshot()) {
+		if local, ok := want[item.MsgName]; ok && item.Local != local {
+			t.Errorf("%s of %s: local = %v, want %v", item.MsgName, item.FileName, item.Local, local)
+		}
+		delete(want, item.MsgName)
+	}
+	if len(want) > 0 {
+		t.Errorf("types not listed: %v", want)
+	}
+}
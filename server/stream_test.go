@@ -0,0 +1,78 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zzong12/hprotoxy/loader"
+)
+
+func TestStreamedBodies(t *testing.T) {
+	var gotLength int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLength = r.ContentLength
+		body, _ := io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/bad":
+			body = []byte("!!!notbase64")
+		case "/bad-chunked":
+			body = []byte("!!!notbase64")
+			w.(http.Flusher).Flush()
+		}
+		w.Write(body)
+	}))
+	defer upstream.Close()
+
+	s, err := NewServer(Config{Sources: []loader.Root{{Path: t.TempDir()}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	large := bytes.Repeat([]byte("0123456789"), streamThreshold/10+1)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       []byte
+		chunked    bool
+		status     int
+		wantLength int64
+	}{
+		{"small body keeps its length", "/echo", []byte("hello"), false, http.StatusOK, 8},
+		{"large body is streamed", "/echo", large, false, http.StatusOK, -1},
+		{"chunked body is streamed", "/echo", []byte("hello"), true, http.StatusOK, -1},
+		{"decode error", "/bad", []byte("hello"), false, http.StatusBadRequest, 8},
+		{"decode error in chunked response", "/bad-chunked", []byte("hello"), false, http.StatusBadRequest, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body io.Reader = bytes.NewReader(tt.body)
+			if tt.chunked {
+				body = io.MultiReader(body) // hides the length
+			}
+			r := httptest.NewRequest(http.MethodPost, upstream.URL+tt.path, body)
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			r.Header.Set(HEADER_REQ_CODEC, "base64:{}")
+			w := httptest.NewRecorder()
+			s.proxyRequest(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if gotLength != tt.wantLength {
+				t.Errorf("upstream content length = %d, want %d", gotLength, tt.wantLength)
+			}
+			if tt.status == http.StatusOK && !bytes.Equal(w.Body.Bytes(), tt.body) {
+				t.Errorf("body not round-tripped, got %d bytes", w.Body.Len())
+			}
+			if tt.status != http.StatusOK && !strings.Contains(w.Body.String(), "Failed to decode response") {
+				t.Errorf("body = %s", w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zzong12/hprotoxy/codec"
+	"github.com/zzong12/hprotoxy/loader"
+)
+
+// previewLimit caps the bytes shown in the per-stage previews.
+const previewLimit = 1024
+
+type (
+	// TranscodeRequest is the body of /do/encode and /do/decode. Chain uses
+	// the ReqCodec syntax and is applied in the given order, or reversed
+	// when Invert is set. Body is decoded according to Encoding: text
+	// (default), hex or base64.
+	TranscodeRequest struct {
+		Chain    string `json:"chain"`
+		Invert   bool   `json:"invert"`
+		Body     string `json:"body"`
+		Encoding string `json:"encoding"`
+	}
+
+	TranscodeStage struct {
+		Codec     string `json:"codec"`
+		Size      int    `json:"size"`
+		Text      string `json:"text,omitempty"`
+		Hex       string `json:"hex"`
+		Base64    string `json:"base64"`
+		Truncated bool   `json:"truncated,omitempty"`
+		Error     string `json:"error,omitempty"`
+	}
+
+	TranscodeResult struct {
+		Status     string            `json:"status"`
+		Error      string            `json:"error,omitempty"`
+		Result     string            `json:"result,omitempty"`
+		Encoding   string            `json:"encoding,omitempty"`
+		Stages     []*TranscodeStage `json:"stages"`
+		Generation uint64            `json:"generation"`
+	}
+)
+
+func decodeBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", "text":
+		return []byte(body), nil
+	case "hex":
+		return hex.DecodeString(strings.Join(strings.Fields(body), ""))
+	case "base64":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	}
+	return nil, fmt.Errorf("unknown body encoding: %s", encoding)
+}
+
+func newTranscodeStage(stage codec.Stage) *TranscodeStage {
+	res := &TranscodeStage{Codec: stage.Codec, Size: len(stage.Output)}
+	if stage.Err != nil {
+		res.Error = stage.Err.Error()
+		return res
+	}
+	preview := stage.Output
+	if len(preview) > previewLimit {
+		preview = preview[:previewLimit]
+		res.Truncated = true
+	}
+	if utf8.Valid(preview) {
+		res.Text = string(preview)
+	}
+	res.Hex = hex.EncodeToString(preview)
+	res.Base64 = base64.StdEncoding.EncodeToString(preview)
+	return res
+}
+
+// ResolveChain resolves a "@profile" reference in chain to the profile's
+// request chain when encoding, or its response chain when decoding. Other
+// chains are returned unchanged.
+func ResolveChain(profiles map[string]Profile, chain string, encode bool) (string, error) {
+	if !strings.HasPrefix(chain, profilePrefix) {
+		return chain, nil
+	}
+	name := chain[len(profilePrefix):]
+	p, ok := profiles[name]
+	if !ok {
+		return "", fmt.Errorf("codec profile not found: %s", name)
+	}
+	if encode {
+		return p.ReqCodec, nil
+	}
+	if p.ResCodec != "" {
+		return p.ResCodec, nil
+	}
+	return invertDesc(p.ReqCodec), nil
+}
+
+func (s *Server) transcode(r *http.Request, encode bool) *TranscodeResult {
+	res := &TranscodeResult{Status: "error", Generation: loader.GetLocalLoader().Snapshot().Generation}
+	if r.Method != "POST" {
+		res.Error = "only POST method is allowed"
+		return res
+	}
+	req := new(TranscodeRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		res.Error = fmt.Sprintf("invalid request: %v", err)
+		return res
+	}
+	body, err := decodeBody(req.Body, req.Encoding)
+	if err != nil {
+		res.Error = fmt.Sprintf("invalid body: %v", err)
+		return res
+	}
+	chain, err := ResolveChain(s.Profiles, req.Chain, encode)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	// only profiles come from the config, other chains from the client
+	cs, err := chainDesc{chain, strings.HasPrefix(req.Chain, profilePrefix)}.parse()
+	if err != nil {
+		res.Error = fmt.Sprintf("invalid chain: %v", err)
+		return res
+	}
+	if req.Invert {
+		cs = cs.Inverted()
+	}
+
+	var stages []codec.Stage
+	if encode {
+		stages, err = cs.EncodeTrace(body)
+	} else {
+		stages, err = cs.DecodeTrace(body)
+	}
+	for _, stage := range stages {
+		res.Stages = append(res.Stages, newTranscodeStage(stage))
+	}
+	if err != nil {
+		res.Error = fmt.Sprintf("stage %d (%s) failed: %v", len(stages), stages[len(stages)-1].Codec, err)
+		return res
+	}
+
+	out := body
+	if len(stages) > 0 {
+		out = stages[len(stages)-1].Output
+	}
+	res.Status = "ok"
+	if utf8.Valid(out) {
+		res.Result = string(out)
+		res.Encoding = "text"
+	} else {
+		res.Result = base64.StdEncoding.EncodeToString(out)
+		res.Encoding = "base64"
+	}
+	return res
+}
+
+func (s *Server) apiEncode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.transcode(r, true))
+}
+
+func (s *Server) apiDecode(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.transcode(r, false))
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func parseUpstream(raw string) (*url.URL, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream %q: %v", raw, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream %q: must be an absolute http or https url", raw)
+	}
+	return u, nil
+}
+
+// upstreamFor returns the upstream base url r must be sent to, or nil when
+// r is a forward proxy request carrying its own absolute url. A route
+// upstream always applies, the global one only to non-proxy requests.
+func (s *Server) upstreamFor(r *http.Request, route *Route) (*url.URL, error) {
+	if route != nil && route.upstream != nil {
+		return route.upstream, nil
+	}
+	if r.URL.IsAbs() {
+		return nil, nil
+	}
+	if s.upstream != nil {
+		return s.upstream, nil
+	}
+	return nil, fmt.Errorf("no upstream for %s, configure Upstream or use hprotoxy as a http proxy", r.URL.Path)
+}
+
+// transportFor returns the transport used to send requests matching route.
+func (s *Server) transportFor(route *Route) http.RoundTripper {
+	if route != nil && route.transport != nil {
+		return route.transport
+	}
+	return s.transport
+}
+
+// rewriteUpstream points r at target, joining the target base path with the
+// request path.
+func rewriteUpstream(r *http.Request, target *url.URL) {
+	r.URL.Scheme = target.Scheme
+	r.URL.Host = target.Host
+	escaped := r.URL.EscapedPath() // before Path changes
+	r.URL.Path = joinPath(target.Path, r.URL.Path)
+	if r.URL.RawPath != "" || target.RawPath != "" {
+		r.URL.RawPath = joinPath(target.EscapedPath(), escaped)
+	}
+	if target.RawQuery != "" {
+		if r.URL.RawQuery == "" {
+			r.URL.RawQuery = target.RawQuery
+		} else {
+			r.URL.RawQuery = target.RawQuery + "&" + r.URL.RawQuery
+		}
+	}
+	r.Host = target.Host
+}
+
+func joinPath(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return strings.TrimSuffix(a, "/") + "/" + strings.TrimPrefix(b, "/")
+}
+
+// TLSConfig configures TLS towards upstream servers.
+type TLSConfig struct {
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string
+	// CertFile/KeyFile is a client certificate for mutual TLS.
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+func (c TLSConfig) isZero() bool {
+	return c == TLSConfig{}
+}
+
+func (c TLSConfig) build() (*tls.Config, error) {
+	cfg := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ca bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca bundle %s", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// newTransport returns a transport to upstream servers using the TLS
+// options of c.
+func newTransport(c TLSConfig) (*http.Transport, error) {
+	tlsCfg, err := c.build()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsCfg
+	return transport, nil
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zzong12/hprotoxy/loader"
+	"github.com/zzong12/hprotoxy/mitm"
+)
+
+func TestJoinPath(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"", "/x", "/x"},
+		{"/base", "", "/base"},
+		{"/base", "/x", "/base/x"},
+		{"/base/", "/x", "/base/x"},
+		{"/base", "x", "/base/x"},
+		{"/base/", "x", "/base/x"},
+		{"/", "/x", "/x"},
+		{"/base", "/", "/base/"},
+		{"/base", "/x/", "/base/x/"},
+	}
+	for _, tt := range tests {
+		if got := joinPath(tt.a, tt.b); got != tt.want {
+			t.Errorf("joinPath(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRewriteUpstream(t *testing.T) {
+	tests := []struct {
+		name     string
+		upstream string
+		target   string
+		want     string
+	}{
+		{"host only", "https://api.example.com", "/v1/users", "https://api.example.com/v1/users"},
+		{"base path", "http://api.example.com/base", "/v1/users", "http://api.example.com/base/v1/users"},
+		{"base path trailing slash", "http://api.example.com/base/", "/v1/users", "http://api.example.com/base/v1/users"},
+		{"root path", "http://api.example.com/", "/v1", "http://api.example.com/v1"},
+		{"trailing slash kept", "http://api.example.com/base", "/v1/", "http://api.example.com/base/v1/"},
+		{"request query", "http://api.example.com/base", "/v1?a=1", "http://api.example.com/base/v1?a=1"},
+		{"upstream query", "http://api.example.com/base?key=k", "/v1", "http://api.example.com/base/v1?key=k"},
+		{"both queries", "http://api.example.com/base?key=k", "/v1?a=1&b=2", "http://api.example.com/base/v1?key=k&a=1&b=2"},
+		{"escaped path", "http://api.example.com/base", "/a%2Fb", "http://api.example.com/base/a%2Fb"},
+		{"escaped base", "http://api.example.com/my%2Fbase", "/v1", "http://api.example.com/my%2Fbase/v1"},
+		{"forward proxy url", "http://127.0.0.1:8080/base", "http://other.com/v1?a=1", "http://127.0.0.1:8080/base/v1?a=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, err := parseUpstream(tt.upstream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("GET", tt.target, nil)
+			rewriteUpstream(r, upstream)
+			if got := r.URL.String(); got != tt.want {
+				t.Errorf("rewritten url = %s, want %s", got, tt.want)
+			}
+			if r.Host != upstream.Host {
+				t.Errorf("host = %s, want %s", r.Host, upstream.Host)
+			}
+		})
+	}
+}
+
+func TestParseUpstream(t *testing.T) {
+	for _, raw := range []string{"api.example.com", "/base", "ftp://a.com", "http://", "http://a.com/%zz"} {
+		if _, err := parseUpstream(raw); err == nil {
+			t.Errorf("parseUpstream(%q) succeeded", raw)
+		}
+	}
+	if u, err := parseUpstream(""); u != nil || err != nil {
+		t.Errorf("parseUpstream(\"\") = %v, %v", u, err)
+	}
+}
+
+func TestUpstreamTLS(t *testing.T) {
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	}))
+	upstream.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+	caFile := write("ca.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: upstream.Certificate().Raw}))
+	certPEM, keyPEM, err := mitm.GenerateCA("test client", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := write("client.pem", certPEM), write("client.key", keyPEM)
+
+	tests := []struct {
+		name       string
+		tls        TLSConfig
+		wantClient string
+		wantErr    bool
+	}{
+		{"system roots", TLSConfig{}, "", true},
+		{"ca file", TLSConfig{CAFile: caFile}, "", false},
+		{"insecure", TLSConfig{InsecureSkipVerify: true}, "", false},
+		{"server name", TLSConfig{CAFile: caFile, ServerName: "example.com"}, "", false},
+		{"other server name", TLSConfig{CAFile: caFile, ServerName: "other.test"}, "", true},
+		{"client cert", TLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}, "test client", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport, err := newTransport(tt.tls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := (&http.Client{Transport: transport}).Get(upstream.URL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			if string(body) != tt.wantClient {
+				t.Errorf("client certificate = %q, want %q", body, tt.wantClient)
+			}
+		})
+	}
+}
+
+func TestUpstreamTLSErrors(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(dir, "missing.pem")
+
+	tests := []struct {
+		name    string
+		tls     TLSConfig
+		wantErr string
+	}{
+		{"missing ca file", TLSConfig{CAFile: missing}, "read ca bundle"},
+		{"empty ca bundle", TLSConfig{CAFile: notPEM}, "no certificates found"},
+		{"missing client cert", TLSConfig{CertFile: missing, KeyFile: missing}, "load client certificate"},
+		{"cert without key", TLSConfig{CertFile: notPEM}, "load client certificate"},
+		{"bad client cert", TLSConfig{CertFile: notPEM, KeyFile: notPEM}, "load client certificate"},
+	}
+	for _, tt := range tests {
+		if _, err := newTransport(tt.tls); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: newTransport error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+
+	_, err := NewServer(Config{Sources: []loader.Root{{Path: dir}}, TLS: TLSConfig{CAFile: missing}})
+	if err == nil || !strings.Contains(err.Error(), "upstream tls") {
+		t.Errorf("NewServer with a missing ca file: error = %v", err)
+	}
+	_, err = NewServer(Config{Sources: []loader.Root{{Path: dir}}, Routes: []Route{{TLS: TLSConfig{CAFile: missing}}}})
+	if err == nil || !strings.Contains(err.Error(), "route 0") {
+		t.Errorf("NewServer with a missing route ca file: error = %v", err)
+	}
+}